@@ -7,10 +7,17 @@ import (
 	"github.com/guoyk93/deployer2/pkg/cmds"
 	"github.com/guoyk93/deployer2/pkg/image_tracker"
 	"github.com/guoyk93/tempfile"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"log"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func exit(err *error) {
@@ -27,9 +34,20 @@ func main() {
 	defer exit(&err)
 	defer tempfile.DeleteAll()
 
-	log.SetOutput(os.Stdout)
 	log.SetPrefix("[deployer2] ")
 
+	// 子命令，日志输出到标准错误，避免干扰命令结果
+	if len(os.Args) > 1 && os.Args[1] == "secret" {
+		err = runSecretCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "preset" {
+		err = runPresetCommand(os.Args[2:])
+		return
+	}
+
+	log.SetOutput(os.Stdout)
+
 	var (
 		optManifest      string
 		optImage         string
@@ -38,6 +56,9 @@ func main() {
 		optCPU           UniversalResource
 		optMEM           UniversalResource
 		optSkipDeploy    bool
+		optPolicyReport  bool
+		optPresetDir     string
+		optPresetSource  string
 		optIgnoreBuilder bool
 
 		imageNames   ImageNames
@@ -48,18 +69,27 @@ func main() {
 	flag.StringVar(&optImage, "image", "", "镜像名")
 	flag.StringVar(&optProfile, "profile", "", "指定环境名")
 	flag.BoolVar(&optSkipDeploy, "skip-deploy", false, "跳过部署流程")
+	flag.StringVar(&optPresetDir, "preset-dir", "", "指定集群预置文件所在的目录，优先于其他搜索目录")
+	flag.StringVar(&optPresetSource, "preset-source", "", "指定远程集群预置文件来源，HTTP(S) 地址或者 secret://MGMT/NAMESPACE/NAME，默认使用环境变量 $"+EnvPresetSource)
+	flag.BoolVar(&optPolicyReport, "policy-report", false, "跳过构建，推送和部署流程，仅输出集群策略的校验结果，不能与 --skip-deploy 同时使用")
 	flag.BoolVar(&optIgnoreBuilder, "ignore-builder", false, "don't use builder image")
-	flag.Var(&optWorkloads, "workload", "指定目标工作负载，格式为 \"CLUSTER/NAMESPACE/TYPE/NAME[/CONTAINER]\"")
-	flag.Var(&optCPU, "cpu", "指定 CPU 配额，格式为 \"MIN:MAX\"，单位为 m (千分之一核心)")
-	flag.Var(&optMEM, "mem", "指定 MEM 配额，格式为 \"MIN:MAX\"，单位为 Mi (兆字节)")
+	flag.Var(&optWorkloads, "workload", "指定目标工作负载，格式为 \"CLUSTER/NAMESPACE/TYPE/NAME[/CONTAINER][?LABELS][+CONTAINER[?LABELS]...]\"，比如 ?role=worker 使用 worker 角色")
+	flag.Var(&optCPU, "cpu", "指定 CPU 配额，格式为 \"MIN:MAX\"，不带单位的整数单位为 m (千分之一核心)，也可以使用 0.5, 500m 等格式")
+	flag.Var(&optMEM, "mem", "指定 MEM 配额，格式为 \"MIN:MAX\"，不带单位的整数单位为 Mi (兆字节)，也可以使用 512Mi, 1Gi 等格式")
 	flag.Parse()
 
+	// 跳过部署时不会生成补丁，无法校验集群策略
+	if optSkipDeploy && optPolicyReport {
+		err = errors.New("--policy-report 不能与 --skip-deploy 同时使用")
+		return
+	}
+
 	// 从 $JOB_NAME 获取 image 和 profile 信息
+	envJobName := strings.TrimSpace(os.Getenv("CCI_JOB_NAME"))
+	if envJobName == "" {
+		envJobName = strings.TrimSpace(os.Getenv("JOB_NAME"))
+	}
 	if optImage == "" || optProfile == "" {
-		envJobName := strings.TrimSpace(os.Getenv("CCI_JOB_NAME"))
-		if envJobName == "" {
-			envJobName = strings.TrimSpace(os.Getenv("JOB_NAME"))
-		}
 		if jobNameSplits := strings.Split(envJobName, "."); len(jobNameSplits) == 2 {
 			if optImage == "" {
 				optImage = jobNameSplits[0]
@@ -104,57 +134,82 @@ func main() {
 	if profile, err = manifest.Profile(optProfile); err != nil {
 		return
 	}
-	// 如果命令行指定了 --mem 和 --cpu，覆盖 Profile 文件中的设置
+	if err = profile.Validate(); err != nil {
+		return
+	}
+	for _, workload := range optWorkloads {
+		if _, err = ResolveUniversalSmoke(&profile, &workload); err != nil {
+			return
+		}
+	}
+	// 如果命令行指定了 --mem 和 --cpu，覆盖 Profile 文件中的设置，包括所有角色中的设置
+	optCPU.Source, optMEM.Source = "--cpu", "--mem"
 	if !optCPU.IsZero() {
 		profile.Resource.CPU = &optCPU
+		for _, role := range profile.Roles {
+			role.Resource.CPU = &optCPU
+		}
 	}
 	if !optMEM.IsZero() {
 		profile.Resource.MEM = &optMEM
+		for _, role := range profile.Roles {
+			role.Resource.MEM = &optMEM
+		}
 	}
-	var fileBuild, filePackage string
-	if fileBuild, filePackage, err = profile.GenerateFiles(); err != nil {
-		return
-	}
-	log.Printf("写入构建文件: %s", fileBuild)
-	log.Printf("写入打包文件: %s", filePackage)
 
-	// 执行构建脚本
-	if profile.Builder.Image != "" && !optIgnoreBuilder {
-		log.Println("------------ 使用容器构建 ------------")
-		cacheGroup := profile.Builder.CacheGroup
-		if cacheGroup == "" {
-			cacheGroup = "default"
-		}
-		var home string
-		if home, err = os.UserHomeDir(); err != nil {
+	// 仅输出集群策略的校验结果时，跳过构建和打包
+	if !optPolicyReport {
+		var fileBuild, filePackage string
+		if fileBuild, filePackage, err = profile.GenerateFiles(); err != nil {
 			return
 		}
-		if err = cmds.ExecuteInDocker(
-			profile.Builder.Image,
-			filepath.Join(home, ".deployer2-builder-cache", cacheGroup),
-			profile.Builder.Caches,
-			fileBuild,
-		); err != nil {
-			return
+		log.Printf("写入构建文件: %s", fileBuild)
+		log.Printf("写入打包文件: %s", filePackage)
+
+		// 执行构建脚本
+		if profile.Builder.Image != "" && !optIgnoreBuilder {
+			log.Println("------------ 使用容器构建 ------------")
+			cacheGroup := profile.Builder.CacheGroup
+			if cacheGroup == "" {
+				cacheGroup = "default"
+			}
+			var home string
+			if home, err = os.UserHomeDir(); err != nil {
+				return
+			}
+			if err = cmds.ExecuteInDocker(
+				profile.Builder.Image,
+				filepath.Join(home, ".deployer2-builder-cache", cacheGroup),
+				profile.Builder.Caches,
+				fileBuild,
+			); err != nil {
+				return
+			}
+		} else {
+			log.Println("------------ 构建 ------------")
+			if err = cmds.Execute(fileBuild); err != nil {
+				return
+			}
 		}
-	} else {
-		log.Println("------------ 构建 ------------")
-		if err = cmds.Execute(fileBuild); err != nil {
+		log.Println("构建完成")
+
+		// 执行打包脚本，即 docker build
+		log.Println("------------ 打包 ------------")
+		if err = cmds.DockerBuild(filePackage, imageNames.Primary()); err != nil {
 			return
 		}
+		log.Printf("打包完成: %s", imageNames.Primary())
+
+		// 追踪涉及到的所有临时镜像，用来做事后清理
+		imageTracker.Add(imageNames.Primary())
+		defer imageTracker.DeleteAll()
 	}
-	log.Println("构建完成")
 
-	// 执行打包脚本，即 docker build
-	log.Println("------------ 打包 ------------")
-	if err = cmds.DockerBuild(filePackage, imageNames.Primary()); err != nil {
+	// 集群预置文件的来源
+	var presetSource PresetSource
+	if presetSource, err = NewPresetSource(optPresetSource, optPresetDir, filepath.Dir(optManifest)); err != nil {
 		return
 	}
-	log.Printf("打包完成: %s", imageNames.Primary())
-
-	// 追踪涉及到的所有临时镜像，用来做事后清理
-	imageTracker.Add(imageNames.Primary())
-	defer imageTracker.DeleteAll()
 
 	// 遍历所有 --workload 参数，执行推送/部署流程
 	for _, workload := range optWorkloads {
@@ -162,10 +217,12 @@ func main() {
 
 		// 加载集群预置文件
 		var preset Preset
-		if err = LoadPresetFromHome(workload.Cluster, &preset); err != nil {
-			if os.IsNotExist(err) {
-				log.Printf("无法找到集群预置文件 %s, 请确认 --workload 参数是否正确", workload.Cluster)
-			}
+		if err = presetSource.Load(workload.Cluster, &preset); err != nil {
+			return
+		}
+
+		// 检查当前任务是否允许部署到目标工作负载，使用 $JOB_NAME 而不是可以随意指定的 --image 参数
+		if err = preset.Access.Check(envJobName, &workload); err != nil {
 			return
 		}
 
@@ -181,6 +238,73 @@ func main() {
 		// 使用指定的远程镜像仓库地址
 		remoteImageNames := imageNames.Derive(preset.Registry)
 
+		// 在推送镜像之前构建附属资源和工作负载补丁，完成集群策略和所属镜像检查
+		var (
+			attachments UniversalAttachments
+			patch       UniversalPatch
+			live        []byte
+		)
+		if !optSkipDeploy {
+			// 构建附属资源，比如由 config 字段生成的 ConfigMap
+			if attachments, err = CreateUniversalAttachments(&preset, &profile, &workload); err != nil {
+				return
+			}
+
+			// 构建工作负载补丁
+			if patch, err = CreateUniversalPatch(&preset, &profile, &workload, &attachments, remoteImageNames.Primary()); err != nil {
+				return
+			}
+
+			// 校验集群策略
+			var results []PolicyResult
+			if results, err = preset.Policies.Evaluate(&workload, &patch); err != nil {
+				return
+			}
+			for _, result := range results {
+				log.Printf("集群策略 %s", result.String())
+			}
+			if optPolicyReport {
+				continue
+			}
+			if err = CheckPolicyResults(results); err != nil {
+				return
+			}
+
+			// 读取集群中的工作负载
+			if live, err = cmds.KubectlGet(kcFile, workload.Namespace, workload.Resource()); err != nil {
+				return
+			}
+
+			// 检查工作负载所属的镜像，避免覆盖其他团队的工作负载
+			if preset.Access.Ownership {
+				owner := AccessImage(envJobName)
+				if owner == "" {
+					err = errors.New("开启 access.ownership 后，必须通过 $JOB_NAME 确定所属镜像")
+					return
+				}
+				var claim bool
+				if claim, err = CheckUniversalOwnership(live, owner); err != nil {
+					return
+				}
+				if claim {
+					log.Printf("记录工作负载所属镜像: %s", owner)
+					patch.ClaimOwnership(owner)
+				}
+			}
+
+			// Service 和中断预算使用工作负载自身的选择器，确保选中滚动更新之前已经存在的 Pod，podLabels 不能修改选择器使用的标签
+			var selector *metav1.LabelSelector
+			if selector, err = ParseUniversalSelector(live); err != nil {
+				return
+			}
+			if err = patch.CheckSelector(selector); err != nil {
+				return
+			}
+			if err = attachments.UseSelector(selector); err != nil {
+				return
+			}
+		}
+
 		// 推送镜像到远程仓库
 		for _, remoteImageName := range remoteImageNames {
 			log.Printf("推送镜像: %s", remoteImageName)
@@ -197,8 +321,58 @@ func main() {
 			continue
 		}
 
-		// 构建工作负载补丁
-		patch := CreateUniversalPatch(&preset, &profile, &workload, remoteImageNames.Primary())
+		// 执行 kubectl apply 命令，创建或者更新附属资源
+		for _, obj := range attachments.Objects() {
+			var buf []byte
+			if buf, err = json.Marshal(obj); err != nil {
+				return
+			}
+			var file string
+			if file, err = tempfile.WriteFile(buf, "deployer-attachment", ".json", false); err != nil {
+				return
+			}
+			if err = cmds.KubectlApply(kcFile, workload.Namespace, file); err != nil {
+				return
+			}
+		}
+
+		// 未设置 autoscale 字段时，删除之前由 deployer2 创建的 HorizontalPodAutoscaler
+		// 如果集群中仍然存在以该工作负载为目标的其他 HorizontalPodAutoscaler，不再设置副本数
+		if attachments.HorizontalPodAutoscaler == nil && workload.IsScalable() {
+			var items []autoscalingv2beta2.HorizontalPodAutoscaler
+			if items, err = listAutoscalers(kcFile, &workload); err != nil {
+				return
+			}
+			expired, rest := ExpiredUniversalAutoscalers(items, &workload)
+			for _, name := range expired {
+				log.Printf("删除 HorizontalPodAutoscaler: %s", name)
+				if err = cmds.KubectlDelete(kcFile, workload.Namespace, "horizontalpodautoscalers.v2beta2.autoscaling/"+name); err != nil {
+					return
+				}
+			}
+			if patch.Spec.Replicas != nil && HasUniversalAutoscaler(rest, &workload) {
+				log.Println("工作负载已由 HorizontalPodAutoscaler 管理，忽略 replicas 字段")
+				patch.Spec.Replicas = nil
+			}
+		}
+
+		// 清理上一次部署时添加，本次不再声明的边车容器
+		var previous []string
+		if previous, err = ParseUniversalSidecars(live); err != nil {
+			return
+		}
+		patch.PruneSidecars(previous)
+		for _, name := range patch.PrunedContainers {
+			log.Printf("移除边车容器: %s", name)
+		}
+
+		// 清理上一次部署时添加，本次不再声明的卷和挂载
+		if err = patch.PruneVolumes(live); err != nil {
+			return
+		}
+		for _, name := range patch.PrunedVolumes {
+			log.Printf("移除卷: %s", name)
+		}
 
 		// 执行 kubectl patch 命令，更新工作负载
 		var buf []byte
@@ -208,5 +382,96 @@ func main() {
 		if err = cmds.KubectlPatch(kcFile, workload.Namespace, workload.Name, workload.Type, string(buf)); err != nil {
 			return
 		}
+
+		// 等待工作负载就绪，并使用工作负载角色中的配置执行冒烟测试
+		var smokeProfile *Profile
+		if smokeProfile, err = ResolveUniversalSmoke(&profile, &workload); err != nil {
+			return
+		}
+		if smokeProfile != nil {
+			if err = runSmokeTests(kcFile, &workload, smokeProfile); err != nil {
+				return
+			}
+		}
+
+		// 清理旧版本的 ConfigMap，失败不影响部署结果
+		if attachments.ConfigMap != nil {
+			if err := cleanupConfigMaps(kcFile, &workload, attachments.ConfigMap.Name, profile.Config.Keep); err != nil {
+				log.Printf("清理旧版本 ConfigMap 失败: %s", err.Error())
+			}
+		}
+	}
+}
+
+func cleanupConfigMaps(kcFile string, workload *UniversalWorkload, current string, keep int) (err error) {
+	var buf []byte
+	if buf, err = cmds.KubectlGet(kcFile, workload.Namespace, "configmaps", "-l", LabelConfigOf+"="+workload.Name); err != nil {
+		return
+	}
+	var list corev1.ConfigMapList
+	if err = json.Unmarshal(buf, &list); err != nil {
+		return
+	}
+	for _, name := range ExpiredUniversalConfigMaps(list.Items, current, keep) {
+		log.Printf("清理旧版本 ConfigMap: %s", name)
+		if err = cmds.KubectlDelete(kcFile, workload.Namespace, "configmaps/"+name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func listAutoscalers(kcFile string, workload *UniversalWorkload) (items []autoscalingv2beta2.HorizontalPodAutoscaler, err error) {
+	var buf []byte
+	if buf, err = cmds.KubectlGet(kcFile, workload.Namespace, "horizontalpodautoscalers.v2beta2.autoscaling"); err != nil {
+		return
+	}
+	var list autoscalingv2beta2.HorizontalPodAutoscalerList
+	if err = json.Unmarshal(buf, &list); err != nil {
+		return
+	}
+	items = list.Items
+	return
+}
+
+func runSmokeTests(kcFile string, workload *UniversalWorkload, profile *Profile) (err error) {
+	rollout := profile.Smoke.Rollout
+	if rollout <= 0 {
+		rollout = SmokeDefaultRollout
+	}
+	if err = cmds.KubectlRolloutStatus(kcFile, workload.Namespace, workload.Resource(), rollout); err != nil {
+		return
+	}
+	port := profile.Smoke.ResolvePort(profile)
+	// 分配本地端口
+	var l net.Listener
+	if l, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return
+	}
+	localPort := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+	var cmd *exec.Cmd
+	if cmd, err = cmds.KubectlPortForward(kcFile, workload.Namespace, workload.Resource(), localPort, port); err != nil {
+		return
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	addr := "127.0.0.1:" + strconv.Itoa(localPort)
+	// 等待 port-forward 就绪
+	for i := 0; ; i++ {
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", addr, time.Second); err == nil {
+			_ = conn.Close()
+			break
+		}
+		if i >= 30 {
+			err = errors.New("等待 kubectl port-forward 就绪超时: " + err.Error())
+			return
+		}
+		time.Sleep(time.Second)
 	}
+	err = RunSmokeTests("http://"+addr, profile.Smoke.Tests)
+	return
 }
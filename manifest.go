@@ -5,6 +5,7 @@ import (
 	"github.com/imdario/mergo"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"path/filepath"
 )
 
 const (
@@ -12,6 +13,8 @@ const (
 )
 
 type Manifest struct {
+	// Dir 描述文件所在的目录，用于解析相对路径
+	Dir      string             `yaml:"-"`
 	Version  int                `yaml:"version"`
 	Default  Profile            `yaml:"default"`
 	Profiles map[string]Profile `yaml:",inline"`
@@ -36,14 +39,24 @@ func LoadManifestFile(file string, m *Manifest) (err error) {
 	if err = LoadManifest(buf, m); err != nil {
 		return
 	}
+	m.Dir = filepath.Dir(file)
 	return
 }
 
 func (m Manifest) Profile(name string) (p Profile, err error) {
 	p = m.Profiles[name]
 	p.Profile = name
+	p.Dir = m.Dir
+	// 环境变量，卷，角色和边车容器按照名称整体覆盖，健康检查使用 UniversalCheck.Merge，不参与 mergo 的深度合并
+	env, volumes, roles, sidecars, check := p.Env, p.Volumes, p.Roles, p.Sidecars, p.Check
+	p.Env, p.Volumes, p.Roles, p.Sidecars, p.Check = nil, nil, nil, nil, UniversalCheck{}
 	if err = mergo.Merge(&p, m.Default); err != nil {
 		return
 	}
+	p.Check = check.Merge(m.Default.Check)
+	p.Env = m.Default.Env.Override(env)
+	p.Volumes = m.Default.Volumes.Override(volumes)
+	p.Roles = m.Default.Roles.Override(roles)
+	p.Sidecars = m.Default.Sidecars.Override(sidecars)
 	return
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
@@ -63,3 +64,155 @@ func TestLoadManifestFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte(testManifestPackage), bytes.TrimSpace(buf))
 }
+
+const (
+	testManifestEnv = `
+version: 2
+default:
+  vars:
+    heap: 512m
+  env:
+    JAVA_OPTS: -Xmx{{.Vars.heap}}
+    REMOVED: hello
+    DB_PASSWORD:
+      secretKeyRef:
+        name: db
+        key: password
+dev:
+  vars:
+    heap: 1g
+  env:
+    REMOVED: ~
+    DB_PASSWORD:
+      fieldRef: metadata.name
+    PROFILE: "{{.Profile}}"
+    APP_MODE:
+      configMapKeyRef:
+        name: app
+        key: mode
+`
+)
+
+func TestManifest_ProfileEnv(t *testing.T) {
+	var m Manifest
+	err := LoadManifest([]byte(testManifestEnv), &m)
+	require.NoError(t, err)
+	p, err := m.Profile("dev")
+	require.NoError(t, err)
+	envs, err := p.Env.Generate(p.Render)
+	require.NoError(t, err)
+	require.Len(t, envs, 4)
+	assert.Equal(t, "APP_MODE", envs[0].Name)
+	assert.Equal(t, "app", envs[0].ValueFrom.ConfigMapKeyRef.Name)
+	assert.Equal(t, "mode", envs[0].ValueFrom.ConfigMapKeyRef.Key)
+	assert.Equal(t, "DB_PASSWORD", envs[1].Name)
+	assert.Nil(t, envs[1].ValueFrom.SecretKeyRef)
+	assert.Equal(t, "metadata.name", envs[1].ValueFrom.FieldRef.FieldPath)
+	assert.Equal(t, "JAVA_OPTS", envs[2].Name)
+	assert.Equal(t, "-Xmx1g", envs[2].Value)
+	assert.Equal(t, "PROFILE", envs[3].Name)
+	assert.Equal(t, "dev", envs[3].Value)
+
+	p, err = m.Profile("default")
+	require.NoError(t, err)
+	envs, err = p.Env.Generate(p.Render)
+	require.NoError(t, err)
+	require.Len(t, envs, 3)
+	assert.Equal(t, "db", envs[0].ValueFrom.SecretKeyRef.Name)
+}
+
+const (
+	testManifestRoles = `
+version: 2
+default:
+  resource:
+    cpu: 200:2000
+    mem: 256:1024
+  check:
+    port: 8080
+    path: /healthz
+  env:
+    MODE: web
+    SHARED: hello
+  roles:
+    worker:
+      resource:
+        mem: 512:2048
+      check:
+        port: 9090
+      command:
+        - /app/worker
+      env:
+        MODE: worker
+        SHARED: ~
+dev:
+  roles:
+    scheduler:
+      command:
+        - /app/scheduler
+`
+)
+
+func TestProfile_Role(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestRoles), &m))
+	p, err := m.Profile("dev")
+	require.NoError(t, err)
+	require.Len(t, p.Roles, 2)
+
+	r, err := p.Role("worker")
+	require.NoError(t, err)
+	assert.Equal(t, "200:2000", r.Resource.CPU.String())
+	assert.Equal(t, "512:2048", r.Resource.MEM.String())
+	assert.Equal(t, 9090, r.Check.Port)
+	assert.Equal(t, "/healthz", r.Check.Path)
+	assert.Equal(t, []string{"/app/worker"}, r.Command)
+	assert.Equal(t, "worker", r.Env["MODE"].Value)
+	assert.Nil(t, r.Env["SHARED"])
+
+	r, err = p.Role("scheduler")
+	require.NoError(t, err)
+	assert.Equal(t, "256:1024", r.Resource.MEM.String())
+	assert.Equal(t, []string{"/app/scheduler"}, r.Command)
+	assert.Equal(t, "web", r.Env["MODE"].Value)
+
+	r, err = p.Role("")
+	require.NoError(t, err)
+	assert.Empty(t, r.Command)
+
+	_, err = p.Role("unknown")
+	assert.Error(t, err)
+}
+
+func TestManifest_ProfileCheckZeroDelay(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(`
+version: 2
+default:
+  check:
+    path: /healthz
+    delay: 30
+    liveness:
+      delay: 120
+    startup:
+      failure: 30
+prod:
+  check:
+    liveness:
+      delay: 0
+    startup:
+      delay: 0
+`), &m))
+	p, err := m.Profile("prod")
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), p.Check.GenerateLivenessProbe().InitialDelaySeconds)
+	assert.Equal(t, int32(0), p.Check.GenerateStartupProbe().InitialDelaySeconds)
+	assert.Equal(t, int32(30), p.Check.GenerateReadinessProbe().InitialDelaySeconds)
+	assert.Equal(t, int32(30), p.Check.GenerateStartupProbe().FailureThreshold)
+
+	// default 环境不受影响
+	d, err := m.Profile("default")
+	require.NoError(t, err)
+	assert.Equal(t, int32(120), d.Check.GenerateLivenessProbe().InitialDelaySeconds)
+	assert.Equal(t, int32(30), d.Check.GenerateStartupProbe().InitialDelaySeconds)
+}
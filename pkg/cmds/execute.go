@@ -45,6 +45,17 @@ func Execute(name string, args ...string) (err error) {
 	return
 }
 
+func ExecuteOutput(name string, args ...string) (out []byte, err error) {
+	log.Printf("执行: %s %s", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	out, err = cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		log.Printf("执行完成: 返回值(%d)", ee.ExitCode())
+	}
+	return
+}
+
 func ExecuteInDocker(image string, cacheDir string, caches []string, script string) (err error) {
 	// 将 caches 换算为 mounts
 	var mounts []string
@@ -152,3 +163,35 @@ func KubectlPatch(kubeconfig, namespace, workload, workloadType, patch string) e
 	return ExecuteWithRetries(KubectlPatchRetries, "kubectl", "--kubeconfig", kubeconfig,
 		"--namespace", namespace, "patch", workloadType+"s/"+workload, "-p", patch)
 }
+
+func KubectlApply(kubeconfig, namespace, file string) error {
+	return ExecuteWithRetries(KubectlPatchRetries, "kubectl", "--kubeconfig", kubeconfig,
+		"--namespace", namespace, "apply", "-f", file)
+}
+
+func KubectlGet(kubeconfig, namespace string, args ...string) ([]byte, error) {
+	return ExecuteOutput("kubectl", append([]string{"--kubeconfig", kubeconfig,
+		"--namespace", namespace, "get", "-o", "json"}, args...)...)
+}
+
+func KubectlDelete(kubeconfig, namespace, resource string) error {
+	return Execute("kubectl", "--kubeconfig", kubeconfig,
+		"--namespace", namespace, "delete", "--ignore-not-found", resource)
+}
+
+func KubectlRolloutStatus(kubeconfig, namespace, resource string, timeout int) error {
+	return Execute("kubectl", "--kubeconfig", kubeconfig,
+		"--namespace", namespace, "rollout", "status", resource, "--timeout", fmt.Sprintf("%ds", timeout))
+}
+
+// KubectlPortForward 在后台启动 kubectl port-forward，调用方负责结束进程
+func KubectlPortForward(kubeconfig, namespace, resource string, localPort, remotePort int) (cmd *exec.Cmd, err error) {
+	args := []string{"--kubeconfig", kubeconfig, "--namespace", namespace,
+		"port-forward", resource, fmt.Sprintf("%d:%d", localPort, remotePort)}
+	log.Printf("执行: kubectl %s", strings.Join(args, " "))
+	cmd = exec.Command("kubectl", args...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	err = cmd.Start()
+	return
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	// Prefix 加密值的前缀，用来区分加密值和明文
+	Prefix = "DEPLOYER2-ENC:v1:"
+)
+
+func newAEAD(key string) (aead cipher.AEAD, err error) {
+	var buf []byte
+	if buf, err = base64.StdEncoding.DecodeString(strings.TrimSpace(key)); err != nil {
+		err = errors.New("密钥格式不正确，需要为 Base64 编码: " + err.Error())
+		return
+	}
+	if len(buf) != 32 {
+		err = errors.New("密钥长度不正确，需要为 32 字节")
+		return
+	}
+	var block cipher.Block
+	if block, err = aes.NewCipher(buf); err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted 判断字符串是否为加密值
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), Prefix)
+}
+
+// Encrypt 使用 AES-256-GCM 加密，key 为 Base64 编码的 32 字节密钥
+func Encrypt(key string, plain []byte) (s string, err error) {
+	var aead cipher.AEAD
+	if aead, err = newAEAD(key); err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	s = Prefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil))
+	return
+}
+
+// Decrypt 解密 Encrypt 生成的加密值
+func Decrypt(key string, s string) (plain []byte, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, Prefix) {
+		err = errors.New("不是有效的加密值，缺少前缀 " + Prefix)
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = newAEAD(key); err != nil {
+		return
+	}
+	var buf []byte
+	if buf, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(s, Prefix)); err != nil {
+		return
+	}
+	if len(buf) < aead.NonceSize() {
+		err = errors.New("加密值长度不正确")
+		return
+	}
+	if plain, err = aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], nil); err != nil {
+		err = errors.New("解密失败，请确认密钥是否正确: " + err.Error())
+		return
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testKey(t *testing.T) string {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := testKey(t)
+	s, err := Encrypt(key, []byte("hello world"))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(s))
+	assert.NotContains(t, s, "hello world")
+
+	buf, err := Decrypt(key, s)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(buf))
+
+	_, err = Decrypt(testKey(t), s)
+	assert.Error(t, err)
+
+	_, err = Decrypt(key, "hello world")
+	assert.Error(t, err)
+
+	_, err = Encrypt("short", []byte("hello world"))
+	assert.Error(t, err)
+}
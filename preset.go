@@ -2,33 +2,97 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/guoyk93/tempfile"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+const (
+	EnvPresetPath   = "DEPLOYER2_PRESET_PATH"
+	PresetDirName   = ".deployer2"
+	PresetSystemDir = "/etc/deployer2"
+)
+
+// PresetDockerAuth 镜像仓库的认证信息
+type PresetDockerAuth struct {
+	Auth string `json:"auth"`
+}
+
 type Preset struct {
+	// Extends 基础集群预置文件的集群名，未设置的字段从 preset-EXTENDS.yml 中继承
+	Extends          string                 `yaml:"extends"`
 	Registry         string                 `yaml:"registry"`
 	Annotations      map[string]string      `yaml:"annotations"`
 	ImagePullSecrets []string               `yaml:"imagePullSecrets"`
 	Resource         UniversalResourceList  `yaml:"resource"`
+	UnlimitedCap     UniversalResourceList  `yaml:"unlimitedCap"`
+	ResourcePolicy   PresetResourcePolicy   `yaml:"resourcePolicy"`
+	Policies         PresetPolicies         `yaml:"policies"`
+	Access           PresetAccess           `yaml:"access"`
+	SecretKey        string                 `yaml:"secretKey"`
+	Ingress          PresetIngress          `yaml:"ingress"`
 	Kubeconfig       map[string]interface{} `yaml:"kubeconfig"`
 	Dockerconfig     struct {
-		Auths map[string]struct {
-			Auth string `json:"auth"`
-		} `json:"auths"`
+		Auths map[string]PresetDockerAuth `json:"auths"`
 	} `yaml:"dockerconfig"`
+
+	UniversalScheduling `yaml:",inline"`
+	UniversalPod        `yaml:",inline"`
+}
+
+// PresetSearchPath 按照优先级返回集群预置文件的搜索目录: --preset-dir 参数, $DEPLOYER2_PRESET_PATH (可以包含多个目录),
+// $HOME/.deployer2, /etc/deployer2, 项目目录下的 .deployer2
+// 项目目录由仓库控制，优先级最低，避免仓库中的文件替换管理员配置的集群预置文件
+func PresetSearchPath(presetDir string, projectDir string) (dirs []string) {
+	if presetDir != "" {
+		dirs = append(dirs, presetDir)
+	}
+	for _, dir := range filepath.SplitList(os.Getenv(EnvPresetPath)) {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, PresetDirName))
+	}
+	dirs = append(dirs, PresetSystemDir)
+	if projectDir != "" {
+		dirs = append(dirs, PresetProjectDir(projectDir))
+	}
+	return
+}
+
+// PresetProjectDir 返回项目目录下的集群预置文件目录，该目录由仓库控制
+func PresetProjectDir(projectDir string) string {
+	return filepath.Join(projectDir, PresetDirName)
+}
+
+// FindPresetFile 在搜索目录中按顺序查找集群预置文件，返回第一个存在的文件
+func FindPresetFile(dirs []string, cluster string) (filename string, err error) {
+	name := "preset-" + cluster + ".yml"
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name)
+		if _, err = os.Stat(candidate); err == nil {
+			filename = candidate
+			return
+		} else if !os.IsNotExist(err) {
+			return
+		}
+	}
+	err = errors.New("无法在以下目录中找到集群预置文件 " + name + ": " + strings.Join(dirs, ", ") + "，请确认 --workload 参数是否正确")
+	return
 }
 
-func LoadPresetFromHome(cluster string, p *Preset) (err error) {
-	var home string
-	if home, err = os.UserHomeDir(); err != nil {
+func LoadPresetFromSearchPath(dirs []string, cluster string, p *Preset) (err error) {
+	var filename string
+	if filename, err = FindPresetFile(dirs, cluster); err != nil {
 		return
 	}
-	filename := filepath.Join(home, ".deployer2", "preset-"+cluster+".yml")
 	log.Printf("加载集群配置: %s", filename)
 	if err = LoadPresetFile(filename, p); err != nil {
 		return
@@ -47,8 +111,25 @@ func LoadPresetFile(filename string, p *Preset) (err error) {
 	return
 }
 
-func LoadPreset(buf []byte, p *Preset) error {
-	return yaml.Unmarshal(buf, p)
+func LoadPreset(buf []byte, p *Preset) (err error) {
+	if err = yaml.Unmarshal(buf, p); err != nil {
+		return
+	}
+	if err = p.Validate(); err != nil {
+		return
+	}
+	return
+}
+
+// Validate 在加载时校验集群预置文件中的策略配置
+func (p Preset) Validate() (err error) {
+	if err = p.ResourcePolicy.Validate(); err != nil {
+		return
+	}
+	if err = p.Policies.Validate(); err != nil {
+		return
+	}
+	return
 }
 
 func (p Preset) GenerateKubeconfig() []byte {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	presetCommandUsage = "用法: deployer2 preset show --cluster CLUSTER [--preset-dir DIR] [--preset-source SOURCE]"
+)
+
+// runPresetCommand 执行 deployer2 preset 子命令，输出合并 extends 之后的集群预置文件，敏感信息会被隐藏
+func runPresetCommand(args []string) (err error) {
+	if len(args) == 0 || args[0] != "show" {
+		err = errors.New(presetCommandUsage)
+		return
+	}
+
+	var (
+		optCluster      string
+		optPresetDir    string
+		optPresetSource string
+	)
+
+	fs := flag.NewFlagSet("deployer2 preset show", flag.ContinueOnError)
+	fs.StringVar(&optCluster, "cluster", "", "指定集群名")
+	fs.StringVar(&optPresetDir, "preset-dir", "", "指定集群预置文件所在的目录，优先于其他搜索目录")
+	fs.StringVar(&optPresetSource, "preset-source", "", "指定远程集群预置文件来源，默认使用环境变量 $"+EnvPresetSource)
+	if err = fs.Parse(args[1:]); err != nil {
+		return
+	}
+	if optCluster == "" {
+		err = errors.New(presetCommandUsage)
+		return
+	}
+
+	var source PresetSource
+	if source, err = NewPresetSource(optPresetSource, optPresetDir, "."); err != nil {
+		return
+	}
+	var preset Preset
+	if err = source.Load(optCluster, &preset); err != nil {
+		return
+	}
+
+	var buf []byte
+	if buf, err = yaml.Marshal(preset.Masked()); err != nil {
+		return
+	}
+	fmt.Print(string(buf))
+	return
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"github.com/imdario/mergo"
+	"strings"
+)
+
+const (
+	// PresetMask 输出集群预置文件时用于替换敏感信息
+	PresetMask = "******"
+)
+
+// presetKubeconfigSecretKeys kubeconfig 中需要隐藏的敏感字段，包括 auth-provider.config 中的令牌和密钥
+var presetKubeconfigSecretKeys = map[string]bool{
+	"token":                   true,
+	"password":                true,
+	"client-key-data":         true,
+	"client-certificate-data": true,
+	"access-token":            true,
+	"refresh-token":           true,
+	"id-token":                true,
+	"client-secret":           true,
+}
+
+// presetKubeconfigEnvKey exec 插件的环境变量，其中的值全部隐藏
+const presetKubeconfigEnvKey = "env"
+
+// Inherit 使用基础集群预置文件 base 补全当前集群预置文件中未设置的字段，规则与环境配置继承 default 相同
+// 资源配额按照资源类型覆盖，kubeconfig 整体覆盖，不参与 mergo 的深度合并
+func (p *Preset) Inherit(base Preset) (err error) {
+	resource, unlimitedCap, kubeconfig := p.Resource, p.UnlimitedCap, p.Kubeconfig
+	p.Resource, p.UnlimitedCap, p.Kubeconfig = UniversalResourceList{}, UniversalResourceList{}, nil
+	if err = mergo.Merge(p, base); err != nil {
+		return
+	}
+	p.Resource = base.Resource.Override(resource)
+	p.UnlimitedCap = base.UnlimitedCap.Override(unlimitedCap)
+	if kubeconfig != nil {
+		p.Kubeconfig = kubeconfig
+	}
+	return
+}
+
+// loadPresetChain 加载集群预置文件，并递归加载 extends 指定的基础集群预置文件，chain 为已经加载的集群名，用于检测循环继承
+// 项目目录中的集群预置文件由仓库控制，只能继承同样来自项目目录的集群预置文件，避免借助 extends 获得管理员配置的 kubeconfig 并绕过访问控制和集群策略
+func loadPresetChain(load func(name string, p *Preset) (bool, error), name string, p *Preset, chain []string) (project bool, err error) {
+	for _, c := range chain {
+		if c == name {
+			err = errors.New("集群预置文件存在循环继承: " + strings.Join(append(chain, name), " -> "))
+			return
+		}
+	}
+	if project, err = load(name, p); err != nil {
+		return
+	}
+	if p.Extends == "" {
+		return
+	}
+	var (
+		base        Preset
+		baseProject bool
+	)
+	if baseProject, err = loadPresetChain(load, p.Extends, &base, append(chain, name)); err != nil {
+		return
+	}
+	if project && !baseProject {
+		err = errors.New("项目目录中的集群预置文件 preset-" + name + ".yml 不能继承管理员配置的集群预置文件 preset-" + p.Extends + ".yml")
+		return
+	}
+	if err = p.Inherit(base); err != nil {
+		return
+	}
+	return
+}
+
+// Masked 返回隐藏了 secretKey，Docker 认证信息和 kubeconfig 中敏感字段的副本，用于输出
+func (p Preset) Masked() Preset {
+	if p.SecretKey != "" {
+		p.SecretKey = PresetMask
+	}
+	if auths := p.Dockerconfig.Auths; auths != nil {
+		p.Dockerconfig.Auths = map[string]PresetDockerAuth{}
+		for k, v := range auths {
+			if v.Auth != "" {
+				v.Auth = PresetMask
+			}
+			p.Dockerconfig.Auths[k] = v
+		}
+	}
+	if p.Kubeconfig != nil {
+		p.Kubeconfig = maskKubeconfig(p.Kubeconfig).(map[string]interface{})
+	}
+	return p
+}
+
+func maskKubeconfig(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[k] = maskKubeconfigField(k, item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := map[interface{}]interface{}{}
+		for k, item := range v {
+			ks, _ := k.(string)
+			out[k] = maskKubeconfigField(ks, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			out = append(out, maskKubeconfig(item))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func maskKubeconfigField(k string, v interface{}) interface{} {
+	if presetKubeconfigSecretKeys[k] {
+		return PresetMask
+	}
+	if k == presetKubeconfigEnvKey {
+		return maskKubeconfigEnv(v)
+	}
+	return maskKubeconfig(v)
+}
+
+// maskKubeconfigEnv 隐藏 exec.env 中每一项的 value，保留 name
+func maskKubeconfigEnv(v interface{}) interface{} {
+	items, ok := v.([]interface{})
+	if !ok {
+		return PresetMask
+	}
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		switch item := item.(type) {
+		case map[string]interface{}:
+			m := map[string]interface{}{}
+			for k, val := range item {
+				if k == "name" {
+					m[k] = val
+				} else {
+					m[k] = PresetMask
+				}
+			}
+			out = append(out, m)
+		case map[interface{}]interface{}:
+			m := map[interface{}]interface{}{}
+			for k, val := range item {
+				if k == "name" {
+					m[k] = val
+				} else {
+					m[k] = PresetMask
+				}
+			}
+			out = append(out, m)
+		default:
+			out = append(out, PresetMask)
+		}
+	}
+	return out
+}
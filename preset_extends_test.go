@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePresetFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "deployer2-preset")
+	require.NoError(t, err)
+	for cluster, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "preset-"+cluster+".yml"), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestPresetSourceExtends(t *testing.T) {
+	dir := writePresetFiles(t, map[string]string{
+		"base": `
+registry: registry.example.com/team
+annotations:
+  a: base
+  b: base
+imagePullSecrets: [regcred]
+resource:
+  cpu: 100:200
+  mem: 200:400
+dockerconfig:
+  auths:
+    registry.example.com:
+      auth: dXNlcjpwYXNz
+kubeconfig:
+  current-context: base
+`,
+		"shared": `
+extends: base
+imagePullSecrets: [shared]
+`,
+		"test": `
+extends: shared
+annotations:
+  a: test
+resource:
+  mem: 300:-
+kubeconfig:
+  current-context: test
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	var p Preset
+	require.NoError(t, PresetSource{Dirs: []string{dir}}.Load("test", &p))
+	assert.Equal(t, "registry.example.com/team", p.Registry)
+	assert.Equal(t, map[string]string{"a": "test", "b": "base"}, p.Annotations)
+	assert.Equal(t, []string{"shared"}, p.ImagePullSecrets)
+	assert.Equal(t, "100:200", p.Resource.CPU.String())
+	assert.Equal(t, "300:-", p.Resource.MEM.String())
+	assert.Equal(t, "dXNlcjpwYXNz", p.Dockerconfig.Auths["registry.example.com"].Auth)
+	assert.Equal(t, map[string]interface{}{"current-context": "test"}, p.Kubeconfig)
+}
+
+func TestPresetSourceExtendsCycle(t *testing.T) {
+	dir := writePresetFiles(t, map[string]string{
+		"a": "extends: b",
+		"b": "extends: c",
+		"c": "extends: a",
+	})
+	defer os.RemoveAll(dir)
+
+	var p Preset
+	err := PresetSource{Dirs: []string{dir}}.Load("a", &p)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "a -> b -> c -> a"))
+
+	p = Preset{}
+	require.Error(t, PresetSource{Dirs: []string{dir}}.Load("missing", &p))
+}
+
+func TestPresetSourceExtendsProject(t *testing.T) {
+	admin := writePresetFiles(t, map[string]string{
+		"prod": `
+registry: registry.example.com/prod
+access:
+  rules:
+    - jobs: ["prod-*"]
+kubeconfig:
+  current-context: prod
+`,
+	})
+	defer os.RemoveAll(admin)
+	project := writePresetFiles(t, map[string]string{
+		"x": `
+extends: prod
+access:
+  rules:
+    - jobs: ["*"]
+`,
+		"y":    "extends: base",
+		"base": "registry: registry.example.com/project",
+	})
+	defer os.RemoveAll(project)
+
+	s := PresetSource{Dirs: []string{admin, project}, ProjectDir: project}
+
+	// 项目目录中的集群预置文件不能继承管理员配置的集群预置文件
+	var p Preset
+	err := s.Load("x", &p)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "preset-prod.yml")
+
+	// 可以继承项目目录中的集群预置文件
+	p = Preset{}
+	require.NoError(t, s.Load("y", &p))
+	assert.Equal(t, "registry.example.com/project", p.Registry)
+
+	// 管理员配置的集群预置文件不受影响
+	p = Preset{}
+	require.NoError(t, s.Load("prod", &p))
+	assert.Equal(t, "registry.example.com/prod", p.Registry)
+}
+
+func TestPresetMasked(t *testing.T) {
+	var p Preset
+	require.NoError(t, LoadPreset([]byte(`
+secretKey: c2VjcmV0
+dockerconfig:
+  auths:
+    registry.example.com:
+      auth: dXNlcjpwYXNz
+kubeconfig:
+  users:
+    - name: test
+      user:
+        token: abc
+        client-key-data: def
+    - name: oidc
+      user:
+        auth-provider:
+          name: oidc
+          config:
+            client-id: deployer
+            client-secret: ghi
+            id-token: jkl
+            refresh-token: mno
+    - name: exec
+      user:
+        exec:
+          command: aws
+          env:
+            - name: AWS_SECRET_ACCESS_KEY
+              value: pqr
+`), &p))
+	m := p.Masked()
+	assert.Equal(t, PresetMask, m.SecretKey)
+	assert.Equal(t, PresetMask, m.Dockerconfig.Auths["registry.example.com"].Auth)
+	user := m.Kubeconfig["users"].([]interface{})[0].(map[interface{}]interface{})["user"].(map[interface{}]interface{})
+	assert.Equal(t, PresetMask, user["token"])
+	assert.Equal(t, PresetMask, user["client-key-data"])
+	user = m.Kubeconfig["users"].([]interface{})[1].(map[interface{}]interface{})["user"].(map[interface{}]interface{})
+	config := user["auth-provider"].(map[interface{}]interface{})["config"].(map[interface{}]interface{})
+	assert.Equal(t, "deployer", config["client-id"])
+	assert.Equal(t, PresetMask, config["client-secret"])
+	assert.Equal(t, PresetMask, config["id-token"])
+	assert.Equal(t, PresetMask, config["refresh-token"])
+	user = m.Kubeconfig["users"].([]interface{})[2].(map[interface{}]interface{})["user"].(map[interface{}]interface{})
+	exec := user["exec"].(map[interface{}]interface{})
+	assert.Equal(t, "aws", exec["command"])
+	env := exec["env"].([]interface{})[0].(map[interface{}]interface{})
+	assert.Equal(t, "AWS_SECRET_ACCESS_KEY", env["name"])
+	assert.Equal(t, PresetMask, env["value"])
+
+	// 原始值不受影响
+	assert.Equal(t, "c2VjcmV0", p.SecretKey)
+	assert.Equal(t, "dXNlcjpwYXNz", p.Dockerconfig.Auths["registry.example.com"].Auth)
+	assert.Contains(t, string(p.GenerateKubeconfig()), "token: abc")
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/guoyk93/deployer2/pkg/cmds"
+	"github.com/guoyk93/tempfile"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	EnvPresetSource = "DEPLOYER2_PRESET_SOURCE"
+	EnvPresetToken  = "DEPLOYER2_PRESET_TOKEN"
+	EnvPresetTTL    = "DEPLOYER2_PRESET_TTL"
+
+	PresetSourceSchemeSecret = "secret"
+	PresetSourceCluster      = "{cluster}"
+
+	PresetDefaultTTL     = time.Minute * 10
+	PresetDefaultTimeout = time.Second * 30
+)
+
+// PresetSource 集群预置文件的来源
+//
+// 未设置 URL 时，从本地搜索目录中加载；URL 可以是 HTTP(S) 地址，其中的 {cluster} 会被替换为集群名，不包含 {cluster} 时在末尾追加 /preset-CLUSTER.yml，请求时使用 Token 作为 Bearer Token；
+// 也可以是 secret://MGMT/NAMESPACE/NAME，从管理集群 MGMT 的 Secret 中读取键 preset-CLUSTER.yml，管理集群的预置文件从项目目录以外的本地搜索目录中加载
+//
+// 远程加载的预置文件缓存在 CacheDir 中，TTL 内不会重复加载，加载失败时会使用过期的缓存
+//
+// ProjectDir 为 Dirs 中由仓库控制的项目目录，其中的预置文件不能继承其他目录或者远程来源中的预置文件
+type PresetSource struct {
+	URL        string
+	Token      string
+	TTL        time.Duration
+	CacheDir   string
+	Dirs       []string
+	ProjectDir string
+}
+
+// NewPresetSource 创建集群预置文件来源，source 为空时使用环境变量 $DEPLOYER2_PRESET_SOURCE，Token 和 TTL 取自环境变量
+// 本地搜索目录参见 PresetSearchPath
+func NewPresetSource(source string, presetDir string, projectDir string) (s PresetSource, err error) {
+	s.URL = strings.TrimSpace(source)
+	if s.URL == "" {
+		s.URL = strings.TrimSpace(os.Getenv(EnvPresetSource))
+	}
+	s.Token = strings.TrimSpace(os.Getenv(EnvPresetToken))
+	s.TTL = PresetDefaultTTL
+	if v := strings.TrimSpace(os.Getenv(EnvPresetTTL)); v != "" {
+		if s.TTL, err = time.ParseDuration(v); err != nil {
+			err = errors.New("环境变量 " + EnvPresetTTL + " 格式不正确: " + err.Error())
+			return
+		}
+	}
+	// 不使用 /tmp 等共享目录作为缓存目录，避免其他用户预先放置集群预置文件
+	if s.URL != "" {
+		var dir string
+		if dir, err = os.UserCacheDir(); err != nil {
+			err = errors.New("无法确定远程集群预置文件的缓存目录: " + err.Error())
+			return
+		}
+		s.CacheDir = filepath.Join(dir, "deployer2")
+	}
+	s.Dirs = PresetSearchPath(presetDir, projectDir)
+	if projectDir != "" {
+		s.ProjectDir = PresetProjectDir(projectDir)
+	}
+	return
+}
+
+// Load 加载指定集群的预置文件，并依次合并 extends 指定的基础集群预置文件
+func (s PresetSource) Load(cluster string, p *Preset) (err error) {
+	_, err = loadPresetChain(s.load, cluster, p, nil)
+	return
+}
+
+// load 加载单个集群预置文件，project 表示该文件来自项目目录
+func (s PresetSource) load(cluster string, p *Preset) (project bool, err error) {
+	if s.URL == "" {
+		var filename string
+		if filename, err = FindPresetFile(s.Dirs, cluster); err != nil {
+			return
+		}
+		project = s.ProjectDir != "" && filepath.Dir(filename) == filepath.Clean(s.ProjectDir)
+		if project {
+			log.Printf("加载项目目录中的集群配置: %s", filename)
+		} else {
+			log.Printf("加载集群配置: %s", filename)
+		}
+		err = LoadPresetFile(filename, p)
+		return
+	}
+	if err = s.prepareCacheDir(); err != nil {
+		return
+	}
+	cacheFile := s.cacheFile(cluster)
+	if info, e := os.Stat(cacheFile); e == nil && time.Since(info.ModTime()) < s.TTL {
+		log.Printf("加载缓存的集群配置: %s", cacheFile)
+		err = LoadPresetFile(cacheFile, p)
+		return
+	}
+	var buf []byte
+	if buf, err = s.fetch(cluster); err == nil {
+		err = LoadPreset(buf, p)
+	}
+	if err != nil {
+		// 远程加载失败时，使用过期的缓存
+		if _, e := os.Stat(cacheFile); e == nil {
+			log.Printf("警告: 远程加载集群配置失败: %s，使用过期的缓存: %s", err.Error(), cacheFile)
+			*p = Preset{}
+			err = LoadPresetFile(cacheFile, p)
+			return
+		}
+		return
+	}
+	if err = ioutil.WriteFile(cacheFile, buf, 0600); err != nil {
+		return
+	}
+	return
+}
+
+// AdminDirs 返回 Dirs 中除项目目录以外，由管理员配置的搜索目录
+func (s PresetSource) AdminDirs() (dirs []string) {
+	for _, dir := range s.Dirs {
+		if s.ProjectDir != "" && filepath.Clean(dir) == filepath.Clean(s.ProjectDir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return
+}
+
+// cacheFile 返回缓存文件路径，文件名包含来源的哈希，切换来源后不会使用其他来源的缓存
+func (s PresetSource) cacheFile(cluster string) string {
+	sum := sha256.Sum256([]byte(s.URL))
+	return filepath.Join(s.CacheDir, "preset-"+cluster+"-"+hex.EncodeToString(sum[:])[:12]+".yml")
+}
+
+// prepareCacheDir 创建缓存目录，缓存中包含 kubeconfig 等敏感信息，目录只允许当前用户访问
+func (s PresetSource) prepareCacheDir() (err error) {
+	if s.CacheDir == "" {
+		err = errors.New("未设置远程集群预置文件的缓存目录")
+		return
+	}
+	if err = os.MkdirAll(s.CacheDir, 0700); err != nil {
+		return
+	}
+	var info os.FileInfo
+	if info, err = os.Stat(s.CacheDir); err != nil {
+		return
+	}
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("缓存目录 %s 的权限 %s 不安全，只允许当前用户访问 (0700)", s.CacheDir, info.Mode().Perm())
+		return
+	}
+	return
+}
+
+func (s PresetSource) fetch(cluster string) (buf []byte, err error) {
+	var u *url.URL
+	if u, err = url.Parse(s.URL); err != nil {
+		return
+	}
+	switch u.Scheme {
+	case "http", "https":
+		target := s.URL
+		if strings.Contains(target, PresetSourceCluster) {
+			target = strings.ReplaceAll(target, PresetSourceCluster, cluster)
+		} else {
+			target = strings.TrimSuffix(target, "/") + "/preset-" + cluster + ".yml"
+		}
+		return s.fetchHTTP(target)
+	case PresetSourceSchemeSecret:
+		return s.fetchSecret(u, cluster)
+	default:
+		err = errors.New("不支持的集群预置文件来源: " + s.URL)
+		return
+	}
+}
+
+func (s PresetSource) fetchHTTP(target string) (buf []byte, err error) {
+	log.Printf("远程加载集群配置: %s", target)
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodGet, target, nil); err != nil {
+		return
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	client := &http.Client{Timeout: PresetDefaultTimeout}
+	var res *http.Response
+	if res, err = client.Do(req); err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if buf, err = ioutil.ReadAll(res.Body); err != nil {
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("远程加载集群配置失败: 状态码 %d", res.StatusCode)
+		return
+	}
+	return
+}
+
+func (s PresetSource) fetchSecret(u *url.URL, cluster string) (buf []byte, err error) {
+	splits := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Host == "" || len(splits) != 2 {
+		err = errors.New("集群预置文件来源格式不正确，应为 secret://MGMT/NAMESPACE/NAME")
+		return
+	}
+	log.Printf("从管理集群 %s 的 Secret %s/%s 加载集群配置", u.Host, splits[0], splits[1])
+	// 管理集群的预置文件只从管理员配置的目录中加载，不使用由仓库控制的项目目录
+	var mgmt Preset
+	if err = (PresetSource{Dirs: s.AdminDirs()}).Load(u.Host, &mgmt); err != nil {
+		return
+	}
+	var kcFile string
+	if kcFile, err = tempfile.WriteFile(mgmt.GenerateKubeconfig(), "deployer-kubeconfig", ".yml", false); err != nil {
+		return
+	}
+	defer os.Remove(kcFile)
+	var out []byte
+	if out, err = cmds.KubectlGet(kcFile, splits[0], "secrets/"+splits[1]); err != nil {
+		return
+	}
+	return PresetFromSecret(out, cluster)
+}
+
+// PresetFromSecret 从 Secret 的 JSON 中读取指定集群的预置文件
+func PresetFromSecret(buf []byte, cluster string) (out []byte, err error) {
+	var secret corev1.Secret
+	if err = json.Unmarshal(buf, &secret); err != nil {
+		return
+	}
+	key := "preset-" + cluster + ".yml"
+	var ok bool
+	if out, ok = secret.Data[key]; !ok {
+		err = errors.New("Secret " + secret.Name + " 中缺少键 " + key)
+		return
+	}
+	return
+}
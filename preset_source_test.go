@@ -0,0 +1,153 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPresetSourceHTTP(t *testing.T) {
+	var hits int
+	var registry = "registry.one"
+	var fail bool
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		hits++
+		if req.Header.Get("Authorization") != "Bearer secret-token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if fail || req.URL.Path != "/presets/preset-test.yml" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write([]byte("registry: " + registry))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "deployer2-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := PresetSource{URL: srv.URL + "/presets", Token: "secret-token", TTL: time.Hour, CacheDir: dir}
+
+	// 首次远程加载，写入缓存
+	var p Preset
+	require.NoError(t, s.Load("test", &p))
+	assert.Equal(t, "registry.one", p.Registry)
+	assert.Equal(t, 1, hits)
+	info, err := os.Stat(s.cacheFile("test"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Equal(t, dir, filepath.Dir(s.cacheFile("test")))
+
+	// TTL 内使用缓存
+	registry = "registry.two"
+	p = Preset{}
+	require.NoError(t, s.Load("test", &p))
+	assert.Equal(t, "registry.one", p.Registry)
+	assert.Equal(t, 1, hits)
+
+	// 切换来源后不使用其他来源的缓存
+	other := s
+	other.URL = srv.URL + "/presets/"
+	p = Preset{}
+	require.NoError(t, other.Load("test", &p))
+	assert.Equal(t, "registry.two", p.Registry)
+	assert.Equal(t, 2, hits)
+
+	// 缓存过期后重新加载
+	s.TTL = 0
+	p = Preset{}
+	require.NoError(t, s.Load("test", &p))
+	assert.Equal(t, "registry.two", p.Registry)
+	assert.Equal(t, 3, hits)
+
+	// 远程加载失败时使用过期的缓存
+	fail = true
+	p = Preset{}
+	require.NoError(t, s.Load("test", &p))
+	assert.Equal(t, "registry.two", p.Registry)
+
+	// 没有缓存时返回错误
+	p = Preset{}
+	require.Error(t, s.Load("missing", &p))
+
+	// Token 不正确
+	s.Token = "wrong"
+	s.CacheDir = filepath.Join(dir, "empty")
+	fail = false
+	require.Error(t, s.Load("test", &p))
+}
+
+func TestPresetSourceCacheDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deployer2-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := PresetSource{URL: "https://example.com/presets", CacheDir: dir}
+	require.NoError(t, s.prepareCacheDir())
+
+	// 其他用户可以访问的缓存目录不可使用
+	require.NoError(t, os.Chmod(dir, 0777))
+	require.Error(t, s.prepareCacheDir())
+	var p Preset
+	require.Error(t, s.Load("test", &p))
+
+	s.CacheDir = ""
+	require.Error(t, s.prepareCacheDir())
+}
+
+func TestPresetSourcePlaceholder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		_, _ = rw.Write([]byte("registry: " + req.URL.Query().Get("cluster")))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "deployer2-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := PresetSource{URL: srv.URL + "/preset?cluster={cluster}", TTL: time.Hour, CacheDir: dir}
+	var p Preset
+	require.NoError(t, s.Load("test", &p))
+	assert.Equal(t, "test", p.Registry)
+}
+
+func TestPresetSourceUnsupported(t *testing.T) {
+	s := PresetSource{URL: "ftp://example.com/presets", CacheDir: "/nonexistent"}
+	var p Preset
+	require.Error(t, s.Load("test", &p))
+	s.URL = "secret://mgmt/only-namespace"
+	require.Error(t, s.Load("test", &p))
+}
+
+func TestPresetSourceAdminDirs(t *testing.T) {
+	s := PresetSource{Dirs: []string{"/opt/flag", "/etc/deployer2", "/src/project/.deployer2"}, ProjectDir: "/src/project/.deployer2/"}
+	assert.Equal(t, []string{"/opt/flag", "/etc/deployer2"}, s.AdminDirs())
+
+	// 仅存在于项目目录中的管理集群预置文件不会被使用
+	project, err := ioutil.TempDir("", "deployer2-project")
+	require.NoError(t, err)
+	defer os.RemoveAll(project)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, "preset-mgmt.yml"), []byte("kubeconfig: {}"), 0644))
+	s = PresetSource{URL: "secret://mgmt/ns/presets", Dirs: []string{project}, ProjectDir: project}
+	_, err = s.fetch("test")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "preset-mgmt.yml")
+}
+
+func TestPresetFromSecret(t *testing.T) {
+	buf := []byte(`{"kind":"Secret","metadata":{"name":"presets"},"data":{"preset-test.yml":"cmVnaXN0cnk6IHJlZ2lzdHJ5Lm9uZQ=="}}`)
+	out, err := PresetFromSecret(buf, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "registry: registry.one", string(out))
+
+	_, err = PresetFromSecret(buf, "missing")
+	require.Error(t, err)
+}
@@ -1 +1,69 @@
 package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPresetSearchPath(t *testing.T) {
+	require.NoError(t, os.Setenv(EnvPresetPath, "/opt/a"+string(os.PathListSeparator)+"/opt/b"))
+	defer os.Unsetenv(EnvPresetPath)
+
+	dirs := PresetSearchPath("/opt/flag", "/src/project")
+	require.True(t, len(dirs) >= 5)
+	assert.Equal(t, []string{"/opt/flag", "/opt/a", "/opt/b"}, dirs[:3])
+	assert.Equal(t, []string{PresetSystemDir, filepath.Join("/src/project", PresetDirName)}, dirs[len(dirs)-2:])
+}
+
+func TestPresetSearchPath_ProjectLast(t *testing.T) {
+	home, err := ioutil.TempDir("", "deployer2-home")
+	require.NoError(t, err)
+	defer os.RemoveAll(home)
+	project, err := ioutil.TempDir("", "deployer2-project")
+	require.NoError(t, err)
+	defer os.RemoveAll(project)
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	require.NoError(t, os.Setenv("HOME", home))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(project, PresetDirName), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, PresetDirName, "preset-test.yml"), []byte("registry: registry.project"), 0644))
+	var p Preset
+	require.NoError(t, LoadPresetFromSearchPath(PresetSearchPath("", project), "test", &p))
+	assert.Equal(t, "registry.project", p.Registry)
+
+	// $HOME 中的集群预置文件优先于项目目录中的文件
+	require.NoError(t, os.MkdirAll(filepath.Join(home, PresetDirName), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, PresetDirName, "preset-test.yml"), []byte("registry: registry.home"), 0644))
+	p = Preset{}
+	require.NoError(t, LoadPresetFromSearchPath(PresetSearchPath("", project), "test", &p))
+	assert.Equal(t, "registry.home", p.Registry)
+}
+
+func TestLoadPresetFromSearchPath(t *testing.T) {
+	dir1, err := ioutil.TempDir("", "deployer2-preset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "deployer2-preset")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir2)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir2, "preset-test.yml"), []byte("registry: registry.two"), 0644))
+	var p Preset
+	require.NoError(t, LoadPresetFromSearchPath([]string{dir1, dir2}, "test", &p))
+	assert.Equal(t, "registry.two", p.Registry)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir1, "preset-test.yml"), []byte("registry: registry.one"), 0644))
+	p = Preset{}
+	require.NoError(t, LoadPresetFromSearchPath([]string{dir1, dir2}, "test", &p))
+	assert.Equal(t, "registry.one", p.Registry)
+
+	err = LoadPresetFromSearchPath([]string{dir1, dir2}, "missing", &p)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), dir1) && strings.Contains(err.Error(), dir2))
+}
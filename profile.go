@@ -2,10 +2,12 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"github.com/guoyk93/deployer2/pkg/tmplfuncs"
 	"github.com/guoyk93/tempfile"
 	"log"
 	"os"
+	"reflect"
 	"strings"
 	"text/template"
 )
@@ -17,13 +19,59 @@ type ProfileBuilder struct {
 }
 
 type Profile struct {
-	Profile  string                 `yaml:"-"`
-	Resource UniversalResourceList  `yaml:"resource"`
-	Check    UniversalCheck         `yaml:"check"`
-	Build    []string               `yaml:"build"`
-	Builder  ProfileBuilder         `yaml:"builder"`
-	Package  []string               `yaml:"package"`
-	Vars     map[string]interface{} `yaml:"vars"`
+	Profile      string                 `yaml:"-"`
+	Dir          string                 `yaml:"-"`
+	Resource     UniversalResourceList  `yaml:"resource"`
+	Check        UniversalCheck         `yaml:"check"`
+	Build        []string               `yaml:"build"`
+	Builder      ProfileBuilder         `yaml:"builder"`
+	Package      []string               `yaml:"package"`
+	Vars         map[string]interface{} `yaml:"vars"`
+	Env          ProfileEnvs            `yaml:"env"`
+	Config       ProfileConfig          `yaml:"config"`
+	Secrets      map[string]string      `yaml:"secrets"`
+	Volumes      ProfileVolumes         `yaml:"volumes"`
+	VolumeMounts []ProfileVolumeMount   `yaml:"volumeMounts"`
+	Command      []string               `yaml:"command"`
+	Args         []string               `yaml:"args"`
+	WorkingDir   string                 `yaml:"workingDir"`
+	Ports        ProfilePorts           `yaml:"ports"`
+	Roles        ProfileRoles           `yaml:"roles"`
+	Smoke        ProfileSmoke           `yaml:"smoke"`
+	Lifecycle    ProfileLifecycle       `yaml:"lifecycle"`
+	Replicas     *int32                 `yaml:"replicas"`
+	Autoscale    *ProfileAutoscale      `yaml:"autoscale"`
+	Expose       *ProfileExpose         `yaml:"expose"`
+	Disruption   *ProfileDisruption     `yaml:"disruption"`
+	Sidecars     ProfileSidecars        `yaml:"sidecars"`
+
+	TerminationGracePeriodSeconds *int64 `yaml:"terminationGracePeriodSeconds"`
+
+	UniversalScheduling `yaml:",inline"`
+	UniversalPod        `yaml:",inline"`
+}
+
+// overrideNamedMap 以 base 为基础，使用 o 中的条目整体覆盖同名条目，o 中值为 null 的条目会被删除，结果写入 out
+// base 和 o 为相同类型的 map[string]*T，out 为指向该类型的指针，base 和 o 都为 nil 时结果为 nil
+func overrideNamedMap(base interface{}, o interface{}, out interface{}) {
+	vb, vo := reflect.ValueOf(base), reflect.ValueOf(o)
+	if vb.IsNil() && vo.IsNil() {
+		return
+	}
+	m := reflect.MakeMap(vb.Type())
+	for _, k := range vb.MapKeys() {
+		if v := vb.MapIndex(k); !v.IsNil() {
+			m.SetMapIndex(k, v)
+		}
+	}
+	for _, k := range vo.MapKeys() {
+		if v := vo.MapIndex(k); v.IsNil() {
+			m.SetMapIndex(k, reflect.Value{})
+		} else {
+			m.SetMapIndex(k, v)
+		}
+	}
+	reflect.ValueOf(out).Elem().Set(m)
 }
 
 func (p *Profile) Render(src string) (out []byte, err error) {
@@ -45,6 +93,7 @@ func (p *Profile) Render(src string) (out []byte, err error) {
 		"Env":     envs,
 		"Vars":    p.Vars,
 		"Profile": p.Profile,
+		"Check":   p.Check.Resolve(nil),
 	}
 
 	buf := &bytes.Buffer{}
@@ -55,6 +104,52 @@ func (p *Profile) Render(src string) (out []byte, err error) {
 	return
 }
 
+// RenderStrings 逐个渲染字符串数组
+func (p *Profile) RenderStrings(srcs []string) (out []string, err error) {
+	for _, src := range srcs {
+		var buf []byte
+		if buf, err = p.Render(src); err != nil {
+			return
+		}
+		out = append(out, string(buf))
+	}
+	return
+}
+
+// Validate 在构建之前校验环境配置，尽早发现错误
+func (p *Profile) Validate() (err error) {
+	if err = p.Ports.Validate(); err != nil {
+		return
+	}
+	if err = p.Check.Validate(); err != nil {
+		return
+	}
+	if err = p.Smoke.Validate(p); err != nil {
+		return
+	}
+	for _, name := range p.Roles.Names() {
+		var rp Profile
+		if rp, err = p.Role(name); err != nil {
+			return
+		}
+		if err = rp.Check.Validate(); err != nil {
+			err = errors.New("角色 " + name + ": " + err.Error())
+			return
+		}
+		if err = rp.Smoke.Validate(&rp); err != nil {
+			err = errors.New("角色 " + name + ": " + err.Error())
+			return
+		}
+	}
+	for _, name := range p.Sidecars.Names() {
+		if err = p.Sidecars[name].Ports.Validate(); err != nil {
+			err = errors.New("边车容器 " + name + ": " + err.Error())
+			return
+		}
+	}
+	return
+}
+
 func (p *Profile) GenerateBuild() ([]byte, error) {
 	s := &strings.Builder{}
 	s.WriteString("#!/bin/bash\nset -eux\n")
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+)
+
+// ProfileEnvKeyRef 引用 Secret 或者 ConfigMap 中的某个键
+type ProfileEnvKeyRef struct {
+	Name     string `yaml:"name"`
+	Key      string `yaml:"key"`
+	Optional bool   `yaml:"optional"`
+}
+
+// ProfileEnv 容器环境变量，可以直接写字符串作为字面值，也可以使用 secretKeyRef, configMapKeyRef 或者 fieldRef 引用其他值
+type ProfileEnv struct {
+	Value           string            `yaml:"value"`
+	SecretKeyRef    *ProfileEnvKeyRef `yaml:"secretKeyRef"`
+	ConfigMapKeyRef *ProfileEnvKeyRef `yaml:"configMapKeyRef"`
+	FieldRef        string            `yaml:"fieldRef"`
+}
+
+func (e *ProfileEnv) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	// 简写格式，直接使用字面值
+	var s string
+	if err = unmarshal(&s); err == nil {
+		e.Value = s
+		return
+	}
+	type alias ProfileEnv
+	var a alias
+	if err = unmarshal(&a); err != nil {
+		return
+	}
+	*e = ProfileEnv(a)
+	return
+}
+
+// ProfileEnvs 容器环境变量集合，子环境中值为 null 的键会删除从 default 继承而来的同名变量
+type ProfileEnvs map[string]*ProfileEnv
+
+// Override 以 es 为基础，使用 o 中的变量整体覆盖同名变量，o 中值为 null 的变量会被删除
+func (es ProfileEnvs) Override(o ProfileEnvs) (out ProfileEnvs) {
+	overrideNamedMap(es, o, &out)
+	return
+}
+
+// Generate 生成容器环境变量，字面值会使用 render 函数进行渲染，结果按照变量名排序
+func (es ProfileEnvs) Generate(render func(src string) ([]byte, error)) (out []corev1.EnvVar, err error) {
+	var keys []string
+	for k, v := range es {
+		if v == nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e := es[k]
+		ev := corev1.EnvVar{Name: k}
+		switch {
+		case e.SecretKeyRef != nil:
+			ev.ValueFrom = &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: e.SecretKeyRef.Name},
+					Key:                  e.SecretKeyRef.Key,
+					Optional:             optionalBool(e.SecretKeyRef.Optional),
+				},
+			}
+		case e.ConfigMapKeyRef != nil:
+			ev.ValueFrom = &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: e.ConfigMapKeyRef.Name},
+					Key:                  e.ConfigMapKeyRef.Key,
+					Optional:             optionalBool(e.ConfigMapKeyRef.Optional),
+				},
+			}
+		case e.FieldRef != "":
+			ev.ValueFrom = &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: e.FieldRef},
+			}
+		default:
+			var buf []byte
+			if buf, err = render(e.Value); err != nil {
+				err = errors.New("渲染环境变量 " + k + " 失败: " + err.Error())
+				return
+			}
+			ev.Value = string(buf)
+		}
+		out = append(out, ev)
+	}
+	return
+}
+
+func optionalBool(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return &b
+}
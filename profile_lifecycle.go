@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"strconv"
+)
+
+// ProfileLifecycleHandler 生命周期钩子，exec 和 sleep 只能设置一个，sleep 会被转换为执行 sleep 命令
+type ProfileLifecycleHandler struct {
+	Exec  []string `yaml:"exec"`
+	Sleep int      `yaml:"sleep"`
+}
+
+func (h ProfileLifecycleHandler) Generate() (out *corev1.Handler, err error) {
+	if len(h.Exec) > 0 && h.Sleep > 0 {
+		err = errors.New("lifecycle 钩子不能同时设置 exec 和 sleep")
+		return
+	}
+	if len(h.Exec) > 0 {
+		out = &corev1.Handler{Exec: &corev1.ExecAction{Command: h.Exec}}
+	} else if h.Sleep > 0 {
+		out = &corev1.Handler{Exec: &corev1.ExecAction{Command: []string{"sleep", strconv.Itoa(h.Sleep)}}}
+	}
+	return
+}
+
+type ProfileLifecycle struct {
+	PreStop ProfileLifecycleHandler `yaml:"preStop"`
+}
+
+// Generate 生成容器的生命周期钩子，如果没有设置任何钩子则返回 nil
+func (l ProfileLifecycle) Generate() (out *corev1.Lifecycle, err error) {
+	var preStop *corev1.Handler
+	if preStop, err = l.PreStop.Generate(); err != nil {
+		return
+	}
+	if preStop != nil {
+		out = &corev1.Lifecycle{PreStop: preStop}
+	}
+	return
+}
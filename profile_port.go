@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"strconv"
+	"strings"
+)
+
+// ProfilePort 容器端口，必须命名
+type ProfilePort struct {
+	Name     string `yaml:"name"`
+	Port     int    `yaml:"port"`
+	Protocol string `yaml:"protocol"`
+}
+
+// GenerateProtocol 返回端口的协议，未设置时为 TCP，只支持 TCP, UDP 和 SCTP
+func (p ProfilePort) GenerateProtocol() (protocol corev1.Protocol, err error) {
+	protocol = corev1.ProtocolTCP
+	if p.Protocol == "" {
+		return
+	}
+	protocol = corev1.Protocol(strings.ToUpper(p.Protocol))
+	switch protocol {
+	case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+	default:
+		err = errors.New("ports 中的端口 " + p.Name + " 的协议 " + p.Protocol + " 不正确，只支持 TCP, UDP 和 SCTP")
+	}
+	return
+}
+
+type ProfilePorts []ProfilePort
+
+// Validate 校验端口名，端口号和协议
+func (ps ProfilePorts) Validate() (err error) {
+	_, err = ps.Generate()
+	return
+}
+
+func (ps ProfilePorts) Generate() (out []corev1.ContainerPort, err error) {
+	names := map[string]bool{}
+	for _, p := range ps {
+		if p.Name == "" {
+			err = errors.New("ports 中的端口 " + strconv.Itoa(p.Port) + " 缺少 name")
+			return
+		}
+		if names[p.Name] {
+			err = errors.New("ports 中存在重复的端口名: " + p.Name)
+			return
+		}
+		names[p.Name] = true
+		if p.Port <= 0 || p.Port > 65535 {
+			err = errors.New("ports 中的端口 " + p.Name + " 的端口号不正确")
+			return
+		}
+		var protocol corev1.Protocol
+		if protocol, err = p.GenerateProtocol(); err != nil {
+			return
+		}
+		out = append(out, corev1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: int32(p.Port),
+			Protocol:      protocol,
+		})
+	}
+	return
+}
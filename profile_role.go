@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+// ProfileRole 角色，同一个环境下的多个工作负载可以使用不同的角色，覆盖环境中的对应字段
+type ProfileRole struct {
+	Resource UniversalResourceList `yaml:"resource"`
+	Check    UniversalCheck        `yaml:"check"`
+	Command  []string              `yaml:"command"`
+	Args     []string              `yaml:"args"`
+	Env      ProfileEnvs           `yaml:"env"`
+	Expose   *ProfileExpose        `yaml:"expose"`
+	Smoke    *ProfileSmoke         `yaml:"smoke"`
+}
+
+// ProfileRoles 角色集合，以角色名为键，子环境中的同名角色整体覆盖 default 中的角色，值为 null 则删除
+type ProfileRoles map[string]*ProfileRole
+
+// Override 以 rs 为基础，使用 o 中的角色整体覆盖同名角色，o 中值为 null 的角色会被删除
+func (rs ProfileRoles) Override(o ProfileRoles) (out ProfileRoles) {
+	overrideNamedMap(rs, o, &out)
+	return
+}
+
+// Names 返回排序后的角色名，忽略值为 null 的角色
+func (rs ProfileRoles) Names() (out []string) {
+	for k, v := range rs {
+		if v != nil {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+// Role 返回应用了指定角色之后的环境配置，角色名为空则返回原环境配置
+func (p Profile) Role(name string) (out Profile, err error) {
+	out = p
+	if name == "" {
+		return
+	}
+	role := p.Roles[name]
+	if role == nil {
+		err = errors.New("环境 " + p.Profile + " 中未定义角色 " + name)
+		return
+	}
+	out.Resource = p.Resource.Override(role.Resource)
+	out.Check = role.Check.Merge(p.Check)
+	if len(role.Command) > 0 {
+		out.Command = role.Command
+	}
+	if len(role.Args) > 0 {
+		out.Args = role.Args
+	}
+	out.Env = p.Env.Override(role.Env)
+	if role.Expose != nil {
+		out.Expose = role.Expose
+	}
+	// 冒烟测试与工作负载提供的接口相关，角色不继承环境中的 smoke，需要在角色中单独设置
+	out.Smoke = ProfileSmoke{}
+	if role.Smoke != nil {
+		out.Smoke = *role.Smoke
+	}
+	return
+}
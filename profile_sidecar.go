@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+const (
+	// AnnotationSidecars 记录 deployer2 添加的边车容器名，逗号分隔，用来在边车容器被移除时清理
+	AnnotationSidecars = "net.guoyk.deployer/sidecars"
+)
+
+// ProfileSidecar 边车容器，比如日志收集，代理等，与主容器一同 patch 到 Pod 模板中
+type ProfileSidecar struct {
+	Image           string                `yaml:"image"`
+	ImagePullPolicy string                `yaml:"imagePullPolicy"`
+	Command         []string              `yaml:"command"`
+	Args            []string              `yaml:"args"`
+	Env             ProfileEnvs           `yaml:"env"`
+	Resource        UniversalResourceList `yaml:"resource"`
+	Ports           ProfilePorts          `yaml:"ports"`
+	VolumeMounts    []ProfileVolumeMount  `yaml:"volumeMounts"`
+}
+
+// ProfileSidecars 边车容器集合，按照容器名整体覆盖，子环境中值为 null 的键会删除从 default 继承而来的边车容器
+type ProfileSidecars map[string]*ProfileSidecar
+
+// Override 以 ss 为基础，使用 o 中的边车容器整体覆盖同名边车容器，o 中值为 null 的边车容器会被删除
+func (ss ProfileSidecars) Override(o ProfileSidecars) (out ProfileSidecars) {
+	overrideNamedMap(ss, o, &out)
+	return
+}
+
+// Names 返回排序后的边车容器名
+func (ss ProfileSidecars) Names() (out []string) {
+	for k, v := range ss {
+		if v != nil {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return
+}
+
+// Generate 生成边车容器，字符串会使用 profile 进行渲染，卷挂载需要引用 profile.volumes 中声明的卷，unlimited 按容器名返回无限制的资源
+func (ss ProfileSidecars) Generate(preset *Preset, profile *Profile) (out []corev1.Container, unlimited map[string][]corev1.ResourceName, err error) {
+	for _, name := range ss.Names() {
+		s := ss[name]
+		if s.Image == "" {
+			err = errors.New("sidecars." + name + " 缺少 image")
+			return
+		}
+		var buf []byte
+		if buf, err = profile.Render(s.Image); err != nil {
+			return
+		}
+		container := corev1.Container{
+			Name:            name,
+			Image:           string(buf),
+			ImagePullPolicy: corev1.PullPolicy(s.ImagePullPolicy),
+		}
+		if container.Command, err = profile.RenderStrings(s.Command); err != nil {
+			return
+		}
+		if container.Args, err = profile.RenderStrings(s.Args); err != nil {
+			return
+		}
+		if container.Env, err = s.Env.Generate(profile.Render); err != nil {
+			return
+		}
+		if container.Ports, err = s.Ports.Generate(); err != nil {
+			return
+		}
+		var names []corev1.ResourceName
+		if container.Resources, names, err = s.Resource.Generate(preset.UnlimitedCap); err != nil {
+			err = errors.New("sidecars." + name + "." + err.Error())
+			return
+		}
+		if container.Resources, names, err = preset.ResourcePolicy.Enforce(name, s.Resource, container.Resources, names); err != nil {
+			return
+		}
+		if len(names) > 0 {
+			if unlimited == nil {
+				unlimited = map[string][]corev1.ResourceName{}
+			}
+			unlimited[name] = names
+		}
+		for _, m := range s.VolumeMounts {
+			if profile.Volumes[m.Name] == nil {
+				err = errors.New("sidecars." + name + ".volumeMounts 引用了未在 volumes 中声明的卷: " + m.Name)
+				return
+			}
+			var vm corev1.VolumeMount
+			if vm, err = m.Generate(); err != nil {
+				return
+			}
+			container.VolumeMounts = append(container.VolumeMounts, vm)
+		}
+		out = append(out, container)
+	}
+	return
+}
+
+// ParseUniversalSidecars 从工作负载的 JSON 中读取上一次部署时 deployer2 添加的边车容器名
+func ParseUniversalSidecars(buf []byte) (names []string, err error) {
+	var obj struct {
+		Spec struct {
+			Template struct {
+				Metadata struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(buf, &obj); err != nil {
+		return
+	}
+	names = splitUniversalNames(obj.Spec.Template.Metadata.Annotations[AnnotationSidecars])
+	return
+}
+
+// splitUniversalNames 拆分注解中逗号分隔的名称列表
+func splitUniversalNames(s string) (names []string) {
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testManifestSidecars = `
+version: 2
+default:
+  volumes:
+    logs:
+      emptyDir: {}
+  sidecars:
+    filebeat:
+      image: filebeat:7
+      resource:
+        cpu: 10:100
+        mem: 32:64
+      volumeMounts:
+        - name: logs
+          mountPath: /var/log/app
+    proxy:
+      image: envoy:1
+dev:
+  sidecars:
+    proxy: ~
+    exporter:
+      image: exporter:{{.Profile}}
+      env:
+        PORT: "9100"
+`
+)
+
+func TestCreateUniversalPatch_Sidecars(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestSidecars), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exporter", "filebeat"}, profile.Sidecars.Names())
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	containers := p.Spec.Template.Spec.Containers
+	require.Len(t, containers, 3)
+	assert.Equal(t, "whoa", containers[0].Name)
+	assert.Equal(t, "exporter", containers[1].Name)
+	assert.Equal(t, "exporter:dev", containers[1].Image)
+	assert.Equal(t, "9100", containers[1].Env[0].Value)
+	assert.Equal(t, "filebeat", containers[2].Name)
+	assert.Equal(t, "100m", containers[2].Resources.Limits.Cpu().String())
+	assert.Equal(t, "/var/log/app", containers[2].VolumeMounts[0].MountPath)
+	assert.Equal(t, "exporter,filebeat", p.Spec.Template.Metadata.Annotations[AnnotationSidecars])
+
+	p.PruneSidecars([]string{"filebeat", "proxy", "whoa"})
+	assert.Equal(t, []string{"proxy"}, p.PrunedContainers)
+
+	buf, err := json.Marshal(p)
+	require.NoError(t, err)
+	var out struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []map[string]interface{} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &out))
+	containersOut := out.Spec.Template.Spec.Containers
+	require.Len(t, containersOut, 4)
+	assert.Equal(t, "proxy", containersOut[3]["name"])
+	assert.Equal(t, "delete", containersOut[3]["$patch"])
+}
+
+func TestCreateUniversalPatch_SidecarsConflict(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+	profile := &Profile{Sidecars: ProfileSidecars{"whoa": {Image: "busybox"}}}
+	_, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+	profile = &Profile{Sidecars: ProfileSidecars{"proxy": {}}}
+	_, err = CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+}
+
+func TestParseUniversalSidecars(t *testing.T) {
+	names, err := ParseUniversalSidecars([]byte(`{"spec":{"template":{"metadata":{"annotations":{"net.guoyk.deployer/sidecars":"filebeat,proxy"}}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"filebeat", "proxy"}, names)
+	names, err = ParseUniversalSidecars([]byte(`{"spec":{}}`))
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
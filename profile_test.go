@@ -1 +1,55 @@
 package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestProfile_Validate(t *testing.T) {
+	p := &Profile{Ports: ProfilePorts{{Name: "http", Port: 8080}, {Name: "dns", Port: 53, Protocol: "udp"}}}
+	require.NoError(t, p.Validate())
+	ports, err := p.Ports.Generate()
+	require.NoError(t, err)
+	assert.Equal(t, corev1.ProtocolTCP, ports[0].Protocol)
+	assert.Equal(t, corev1.ProtocolUDP, ports[1].Protocol)
+
+	p.Ports[1].Protocol = "http"
+	assert.Error(t, p.Validate())
+
+	p.Ports[1].Protocol = "SCTP"
+	p.Sidecars = ProfileSidecars{"proxy": {Ports: ProfilePorts{{Name: "proxy", Port: 15001, Protocol: "quic"}}}}
+	err = p.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "proxy")
+}
+
+func TestProfile_ValidateCheck(t *testing.T) {
+	p := &Profile{Check: UniversalCheck{Type: "udp"}}
+	assert.Error(t, p.Validate())
+
+	p.Check.Type = CheckTypeTCP
+	p.Roles = ProfileRoles{"worker": {Check: UniversalCheck{Readiness: &UniversalCheck{Type: CheckTypeExec}}}}
+	err := p.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "worker")
+
+	p.Roles["worker"].Check.Readiness.Command = []string{"true"}
+	assert.NoError(t, p.Validate())
+}
+
+func TestOverrideNamedMap(t *testing.T) {
+	var out ProfileVolumes
+	overrideNamedMap(ProfileVolumes(nil), ProfileVolumes(nil), &out)
+	assert.Nil(t, out)
+
+	data, logs := &ProfileVolume{}, &ProfileVolume{}
+	base := ProfileVolumes{"data": data, "logs": logs, "tmp": nil}
+	out = base.Override(ProfileVolumes{"logs": nil, "cache": data})
+	assert.Equal(t, ProfileVolumes{"data": data, "cache": data}, out)
+	assert.Len(t, base, 3)
+
+	assert.Equal(t, ProfileEnvs{"A": {Value: "1"}}, ProfileEnvs(nil).Override(ProfileEnvs{"A": {Value: "1"}, "B": nil}))
+	assert.Equal(t, ProfileRoles{}, ProfileRoles{"worker": nil}.Override(nil))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sort"
+)
+
+const (
+	// AnnotationVolumes 记录 deployer2 添加的卷名，逗号分隔，用来在卷被移除时清理
+	AnnotationVolumes = "net.guoyk.deployer/volumes"
+)
+
+type ProfileVolumeEmptyDir struct {
+	Medium    string `yaml:"medium"`
+	SizeLimit string `yaml:"sizeLimit"`
+}
+
+type ProfileVolumeHostPath struct {
+	Path string `yaml:"path"`
+	Type string `yaml:"type"`
+}
+
+type ProfileVolumeConfigMap struct {
+	Name     string `yaml:"name"`
+	Optional bool   `yaml:"optional"`
+}
+
+type ProfileVolumeSecret struct {
+	Name     string `yaml:"name"`
+	Optional bool   `yaml:"optional"`
+}
+
+type ProfileVolumePVC struct {
+	ClaimName string `yaml:"claimName"`
+	ReadOnly  bool   `yaml:"readOnly"`
+}
+
+// ProfileVolume 卷，只能设置一种来源
+type ProfileVolume struct {
+	EmptyDir              *ProfileVolumeEmptyDir  `yaml:"emptyDir"`
+	HostPath              *ProfileVolumeHostPath  `yaml:"hostPath"`
+	ConfigMap             *ProfileVolumeConfigMap `yaml:"configMap"`
+	Secret                *ProfileVolumeSecret    `yaml:"secret"`
+	PersistentVolumeClaim *ProfileVolumePVC       `yaml:"persistentVolumeClaim"`
+}
+
+func (v ProfileVolume) Generate(name string) (out corev1.Volume, err error) {
+	out.Name = name
+	var count int
+	if v.EmptyDir != nil {
+		count++
+		out.EmptyDir = &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMedium(v.EmptyDir.Medium)}
+		if v.EmptyDir.SizeLimit != "" {
+			var q resource.Quantity
+			if q, err = resource.ParseQuantity(v.EmptyDir.SizeLimit); err != nil {
+				err = errors.New("卷 " + name + " 的 emptyDir.sizeLimit 格式不正确: " + err.Error())
+				return
+			}
+			out.EmptyDir.SizeLimit = &q
+		}
+	}
+	if v.HostPath != nil {
+		count++
+		if v.HostPath.Path == "" {
+			err = errors.New("卷 " + name + " 缺少 hostPath.path")
+			return
+		}
+		out.HostPath = &corev1.HostPathVolumeSource{Path: v.HostPath.Path}
+		if v.HostPath.Type != "" {
+			t := corev1.HostPathType(v.HostPath.Type)
+			out.HostPath.Type = &t
+		}
+	}
+	if v.ConfigMap != nil {
+		count++
+		if v.ConfigMap.Name == "" {
+			err = errors.New("卷 " + name + " 缺少 configMap.name")
+			return
+		}
+		out.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: v.ConfigMap.Name},
+			Optional:             optionalBool(v.ConfigMap.Optional),
+		}
+	}
+	if v.Secret != nil {
+		count++
+		if v.Secret.Name == "" {
+			err = errors.New("卷 " + name + " 缺少 secret.name")
+			return
+		}
+		out.Secret = &corev1.SecretVolumeSource{
+			SecretName: v.Secret.Name,
+			Optional:   optionalBool(v.Secret.Optional),
+		}
+	}
+	if v.PersistentVolumeClaim != nil {
+		count++
+		if v.PersistentVolumeClaim.ClaimName == "" {
+			err = errors.New("卷 " + name + " 缺少 persistentVolumeClaim.claimName")
+			return
+		}
+		out.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: v.PersistentVolumeClaim.ClaimName,
+			ReadOnly:  v.PersistentVolumeClaim.ReadOnly,
+		}
+	}
+	if count != 1 {
+		err = errors.New("卷 " + name + " 必须设置且只能设置一种来源 (emptyDir, hostPath, configMap, secret, persistentVolumeClaim)")
+		return
+	}
+	return
+}
+
+// ProfileVolumes 卷集合，以卷名为键，子环境中值为 null 的键会删除从 default 继承而来的同名卷
+type ProfileVolumes map[string]*ProfileVolume
+
+// Override 以 vs 为基础，使用 o 中的卷整体覆盖同名卷，o 中值为 null 的卷会被删除
+func (vs ProfileVolumes) Override(o ProfileVolumes) (out ProfileVolumes) {
+	overrideNamedMap(vs, o, &out)
+	return
+}
+
+// Generate 生成 Pod 的卷列表，按照卷名排序
+func (vs ProfileVolumes) Generate() (out []corev1.Volume, err error) {
+	var names []string
+	for k, v := range vs {
+		if v == nil {
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var v corev1.Volume
+		if v, err = vs[name].Generate(name); err != nil {
+			return
+		}
+		out = append(out, v)
+	}
+	return
+}
+
+type ProfileVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	SubPath   string `yaml:"subPath"`
+	ReadOnly  bool   `yaml:"readOnly"`
+}
+
+func (m ProfileVolumeMount) Generate() (out corev1.VolumeMount, err error) {
+	if m.Name == "" || m.MountPath == "" {
+		err = errors.New("volumeMounts 中的条目必须设置 name 和 mountPath")
+		return
+	}
+	out = corev1.VolumeMount{
+		Name:      m.Name,
+		MountPath: m.MountPath,
+		SubPath:   m.SubPath,
+		ReadOnly:  m.ReadOnly,
+	}
+	return
+}
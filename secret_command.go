@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/guoyk93/deployer2/pkg/secrets"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	secretCommandUsage = "用法: deployer2 secret encrypt --cluster CLUSTER [--value VALUE] [--preset-dir DIR] [--preset-source SOURCE]"
+)
+
+// runSecretCommand 执行 deployer2 secret 子命令，使用集群预置文件中的 secretKey 加密 secrets 字段的值
+func runSecretCommand(args []string) (err error) {
+	if len(args) == 0 || args[0] != "encrypt" {
+		err = errors.New(secretCommandUsage)
+		return
+	}
+
+	var (
+		optCluster      string
+		optValue        string
+		optPresetDir    string
+		optPresetSource string
+	)
+
+	fs := flag.NewFlagSet("deployer2 secret encrypt", flag.ContinueOnError)
+	fs.StringVar(&optCluster, "cluster", "", "指定集群名，使用该集群预置文件中的 secretKey 加密")
+	fs.StringVar(&optValue, "value", "", "要加密的值，如果未指定，则从标准输入读取")
+	fs.StringVar(&optPresetDir, "preset-dir", "", "指定集群预置文件所在的目录，优先于其他搜索目录")
+	fs.StringVar(&optPresetSource, "preset-source", "", "指定远程集群预置文件来源，默认使用环境变量 $"+EnvPresetSource)
+	if err = fs.Parse(args[1:]); err != nil {
+		return
+	}
+	if optCluster == "" {
+		err = errors.New(secretCommandUsage)
+		return
+	}
+
+	var source PresetSource
+	if source, err = NewPresetSource(optPresetSource, optPresetDir, "."); err != nil {
+		return
+	}
+	var preset Preset
+	if err = source.Load(optCluster, &preset); err != nil {
+		return
+	}
+	if preset.SecretKey == "" {
+		err = errors.New("集群预置文件中缺少 secretKey")
+		return
+	}
+
+	value := []byte(optValue)
+	if optValue == "" {
+		if value, err = ioutil.ReadAll(os.Stdin); err != nil {
+			return
+		}
+		value = []byte(strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r"))
+	}
+
+	var s string
+	if s, err = secrets.Encrypt(preset.SecretKey, value); err != nil {
+		return
+	}
+	fmt.Println(s)
+	return
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SmokeDefaultRetries  = 3
+	SmokeDefaultInterval = 5
+	SmokeDefaultTimeout  = 10
+	SmokeDefaultRollout  = 600
+)
+
+// SmokeTest 冒烟测试，部署完成后发送 HTTP 请求，校验返回的状态码和响应体
+type SmokeTest struct {
+	Name     string            `yaml:"name"`
+	Method   string            `yaml:"method"`
+	Path     string            `yaml:"path"`
+	Headers  map[string]string `yaml:"headers"`
+	Body     string            `yaml:"body"`
+	Status   int               `yaml:"status"`
+	Match    string            `yaml:"match"`
+	Retries  *int              `yaml:"retries"`
+	Interval int               `yaml:"interval"`
+	Timeout  int               `yaml:"timeout"`
+}
+
+// ProfileSmoke 冒烟测试配置，通过 kubectl port-forward 连接到工作负载的 port 端口执行
+type ProfileSmoke struct {
+	Port    int         `yaml:"port"`
+	Rollout int         `yaml:"rollout"`
+	Tests   []SmokeTest `yaml:"tests"`
+}
+
+// ResolvePort 返回冒烟测试连接的端口，默认为 check.port
+func (s ProfileSmoke) ResolvePort(profile *Profile) int {
+	if s.Port != 0 {
+		return s.Port
+	}
+	return profile.Check.Resolve(nil).Port
+}
+
+// Validate 校验冒烟测试的端口是否由容器提供，即 ports 中声明的端口或者健康检查的端口
+func (s ProfileSmoke) Validate(profile *Profile) (err error) {
+	if len(s.Tests) == 0 {
+		return
+	}
+	port := s.ResolvePort(profile)
+	if port == 0 {
+		err = errors.New("smoke 缺少 port，且未设置 check.port")
+		return
+	}
+	if port == profile.Check.Resolve(nil).Port {
+		return
+	}
+	for _, p := range profile.Ports {
+		if p.Port == port {
+			return
+		}
+	}
+	err = errors.New("smoke.port " + strconv.Itoa(port) + " 未在 ports 中声明，也不是 check.port")
+	return
+}
+
+// ResolveUniversalSmoke 返回工作负载执行冒烟测试使用的环境配置，即主容器 role 标签指定的角色，不需要冒烟测试时返回 nil
+// 只包含初始化容器的工作负载不执行冒烟测试，cronjob 类型的工作负载不支持冒烟测试，在构建之前返回错误
+func ResolveUniversalSmoke(profile *Profile, workload *UniversalWorkload) (out *Profile, err error) {
+	primary := workload.Primary()
+	if primary.Labels.Init {
+		return
+	}
+	var rp *Profile
+	if rp, err = resolveUniversalRole(profile, primary.Labels.Role); err != nil {
+		return
+	}
+	if len(rp.Smoke.Tests) == 0 {
+		return
+	}
+	if workload.Type == "cronjob" {
+		err = errors.New("cronjob 类型的工作负载不支持冒烟测试: " + workload.String())
+		return
+	}
+	out = rp
+	return
+}
+
+func (t SmokeTest) title() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	method := t.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + t.Path
+}
+
+func (t SmokeTest) run(baseURL string) (err error) {
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = SmokeDefaultTimeout
+	}
+	status := t.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest(method, strings.TrimSuffix(baseURL, "/")+"/"+strings.TrimPrefix(t.Path, "/"), strings.NewReader(t.Body)); err != nil {
+		return
+	}
+	var names []string
+	for name := range t.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, "Host") {
+			req.Host = t.Headers[name]
+		} else {
+			req.Header.Set(name, t.Headers[name])
+		}
+	}
+
+	client := &http.Client{Timeout: time.Second * time.Duration(timeout)}
+	var res *http.Response
+	if res, err = client.Do(req); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	var buf []byte
+	if buf, err = ioutil.ReadAll(res.Body); err != nil {
+		return
+	}
+	if res.StatusCode != status {
+		err = fmt.Errorf("状态码 %d 不符合预期 %d", res.StatusCode, status)
+		return
+	}
+	if t.Match != "" {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(t.Match); err != nil {
+			return
+		}
+		if !re.Match(buf) {
+			err = fmt.Errorf("响应体不匹配正则表达式 %s", t.Match)
+			return
+		}
+	}
+	return
+}
+
+// RunSmokeTests 依次执行冒烟测试，每项测试失败后会按照 retries 和 interval 重试，最多执行 1 + retries 次，任意一项最终失败则返回错误
+func RunSmokeTests(baseURL string, tests []SmokeTest) (err error) {
+	for _, t := range tests {
+		retries := SmokeDefaultRetries
+		if t.Retries != nil {
+			retries = *t.Retries
+		}
+		interval := t.Interval
+		if interval <= 0 {
+			interval = SmokeDefaultInterval
+		}
+		for {
+			log.Printf("冒烟测试: %s", t.title())
+			if err = t.run(baseURL); err == nil {
+				log.Printf("冒烟测试通过: %s", t.title())
+				break
+			}
+			if retries <= 0 {
+				err = errors.New("冒烟测试失败: " + t.title() + ": " + err.Error())
+				return
+			}
+			log.Printf("冒烟测试失败: %s: %s, %ds 后重试, 剩余 %d 次", t.title(), err.Error(), interval, retries)
+			retries--
+			time.Sleep(time.Second * time.Duration(interval))
+		}
+	}
+	return
+}
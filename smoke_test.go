@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunSmokeTests(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/healthz":
+			_, _ = rw.Write([]byte(`{"status":"ok","host":"` + req.Host + `","x":"` + req.Header.Get("X-Test") + `"}`))
+		case "/flaky":
+			calls++
+			if calls < 2 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = rw.Write([]byte("ok"))
+		case "/created":
+			if req.Method != http.MethodPost {
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			rw.WriteHeader(http.StatusCreated)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	err := RunSmokeTests(s.URL, []SmokeTest{
+		{
+			Path:    "/healthz",
+			Headers: map[string]string{"Host": "example.com", "X-Test": "hello"},
+			Match:   `"status":"ok","host":"example.com","x":"hello"`,
+		},
+		{Path: "flaky", Interval: 1},
+		{Name: "create", Method: "post", Path: "/created", Status: http.StatusCreated},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// retries 为 0 时只执行一次
+	noRetry := 0
+	err = RunSmokeTests(s.URL, []SmokeTest{{Path: "/healthz", Match: "failed", Retries: &noRetry}})
+	assert.Error(t, err)
+
+	err = RunSmokeTests(s.URL, []SmokeTest{{Path: "/missing", Retries: &noRetry}})
+	assert.Error(t, err)
+
+	calls = 0
+	err = RunSmokeTests(s.URL, []SmokeTest{{Path: "flaky", Retries: &noRetry}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	// retries 为 1 时最多执行两次
+	retries := 1
+	calls = 0
+	err = RunSmokeTests(s.URL, []SmokeTest{{Path: "flaky", Retries: &retries, Interval: 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestProfileSmoke_Validate(t *testing.T) {
+	p := &Profile{
+		Check: UniversalCheck{Port: 8080},
+		Ports: ProfilePorts{{Name: "admin", Port: 9090}},
+		Smoke: ProfileSmoke{Tests: []SmokeTest{{Path: "/"}}},
+	}
+	assert.NoError(t, p.Smoke.Validate(p))
+	assert.Equal(t, 8080, p.Smoke.ResolvePort(p))
+	p.Smoke.Port = 9090
+	assert.NoError(t, p.Smoke.Validate(p))
+	p.Smoke.Port = 7070
+	assert.Error(t, p.Smoke.Validate(p))
+	assert.Error(t, p.Validate())
+}
+
+func TestResolveUniversalSmoke(t *testing.T) {
+	p := &Profile{
+		Check: UniversalCheck{Port: 8080},
+		Smoke: ProfileSmoke{Tests: []SmokeTest{{Path: "/"}}},
+		Roles: ProfileRoles{
+			"worker": {},
+			"admin": {
+				Check: UniversalCheck{Port: 9090},
+				Smoke: &ProfileSmoke{Tests: []SmokeTest{{Path: "/admin"}}},
+			},
+		},
+	}
+	resolve := func(s string) (*Profile, error) {
+		var w UniversalWorkload
+		require.NoError(t, w.Set(s))
+		return ResolveUniversalSmoke(p, &w)
+	}
+
+	sp, err := resolve("test/default/deployment/web")
+	require.NoError(t, err)
+	require.NotNil(t, sp)
+	assert.Equal(t, 8080, sp.Smoke.ResolvePort(sp))
+
+	// 角色不继承环境中的 smoke
+	sp, err = resolve("test/default/deployment/worker?role=worker")
+	require.NoError(t, err)
+	assert.Nil(t, sp)
+
+	// 使用角色中的 smoke 和 check.port
+	sp, err = resolve("test/default/deployment/admin?role=admin")
+	require.NoError(t, err)
+	require.NotNil(t, sp)
+	assert.Equal(t, "/admin", sp.Smoke.Tests[0].Path)
+	assert.Equal(t, 9090, sp.Smoke.ResolvePort(sp))
+
+	// 只包含初始化容器时不执行冒烟测试
+	sp, err = resolve("test/default/deployment/web/migrate?init")
+	require.NoError(t, err)
+	assert.Nil(t, sp)
+
+	_, err = resolve("test/default/cronjob/web")
+	require.Error(t, err)
+	_, err = resolve("test/default/cronjob/worker?role=worker")
+	require.NoError(t, err)
+	// 校验角色中的 smoke.port
+	require.NoError(t, p.Validate())
+	p.Roles["admin"].Smoke.Port = 7070
+	assert.Error(t, p.Validate())
+}
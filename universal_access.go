@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// AnnotationOwner 记录工作负载所属的镜像名，开启 access.ownership 后，只有同名镜像可以更新该工作负载
+	AnnotationOwner = "net.guoyk.deployer/owner"
+)
+
+// PresetAccessRule 访问规则，任务名匹配 jobs，或者任务名中的镜像名匹配 images 时，允许部署到 namespaces 和 workloads 中的工作负载
+// 所有字段均支持通配符，namespaces 和 workloads 为空代表不限制
+type PresetAccessRule struct {
+	Images     []string `yaml:"images"`
+	Jobs       []string `yaml:"jobs"`
+	Namespaces []string `yaml:"namespaces"`
+	Workloads  []string `yaml:"workloads"`
+}
+
+func (r PresetAccessRule) matches(job string) bool {
+	if job == "" {
+		return false
+	}
+	image := AccessImage(job)
+	return (len(r.Images) > 0 && image != "" && matchPatterns(r.Images, image)) ||
+		(len(r.Jobs) > 0 && matchPatterns(r.Jobs, job))
+}
+
+func (r PresetAccessRule) allows(workload *UniversalWorkload) bool {
+	return (len(r.Namespaces) == 0 || matchPatterns(r.Namespaces, workload.Namespace)) &&
+		(len(r.Workloads) == 0 || matchPatterns(r.Workloads, workload.Name))
+}
+
+// AccessImage 返回任务名 IMAGE.PROFILE 中的镜像名，用于访问控制和所属镜像检查，无法解析时返回空字符串
+// 不使用 --image 参数，因为该参数可以由任务随意指定
+func AccessImage(job string) string {
+	if splits := strings.Split(job, "."); len(splits) == 2 {
+		return strings.TrimSpace(splits[0])
+	}
+	return ""
+}
+
+// PresetAccess 集群访问控制，rules 为空代表不限制
+type PresetAccess struct {
+	Rules     []PresetAccessRule `yaml:"rules"`
+	Ownership bool               `yaml:"ownership"`
+}
+
+// Check 检查任务 job 是否允许部署到指定工作负载
+func (a PresetAccess) Check(job string, workload *UniversalWorkload) (err error) {
+	if len(a.Rules) == 0 {
+		return
+	}
+	if job == "" {
+		err = errors.New("集群预置文件设置了 access.rules，必须通过 $JOB_NAME 确定任务名")
+		return
+	}
+	for _, r := range a.Rules {
+		if r.matches(job) && r.allows(workload) {
+			return
+		}
+	}
+	err = errors.New("任务 " + job + " 不允许部署到 " + workload.Namespace + "/" + workload.Name + "，请检查集群预置文件的 access 字段")
+	return
+}
+
+// CheckUniversalOwnership 检查工作负载 JSON 中记录的所属镜像，属于其他镜像时返回错误，claim 为 true 代表工作负载尚未记录所属镜像
+func CheckUniversalOwnership(buf []byte, owner string) (claim bool, err error) {
+	var obj struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err = json.Unmarshal(buf, &obj); err != nil {
+		return
+	}
+	current := obj.Metadata.Annotations[AnnotationOwner]
+	if current == "" {
+		claim = true
+		return
+	}
+	if current != owner {
+		err = errors.New("工作负载属于镜像 " + current + "，不允许使用镜像 " + owner + " 更新")
+		return
+	}
+	return
+}
+
+// ClaimOwnership 在补丁中记录工作负载所属的镜像
+func (p *UniversalPatch) ClaimOwnership(owner string) {
+	annotations := map[string]string{}
+	for k, v := range p.Metadata.Annotations {
+		annotations[k] = v
+	}
+	annotations[AnnotationOwner] = owner
+	p.Metadata.Annotations = annotations
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testPresetAccess = `
+access:
+  ownership: true
+  rules:
+    - images: ["team-a-*"]
+      namespaces: ["team-a", "team-a-*"]
+    - jobs: ["ops-*"]
+      namespaces: ["infra"]
+      workloads: ["ingress-*"]
+`
+)
+
+func TestPresetAccess_Check(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetAccess), &preset))
+	assert.True(t, preset.Access.Ownership)
+
+	workload := func(s string) *UniversalWorkload {
+		w := &UniversalWorkload{}
+		require.NoError(t, w.Set(s))
+		return w
+	}
+
+	// images 匹配任务名中的镜像名
+	assert.NoError(t, preset.Access.Check("team-a-web.prod", workload("c/team-a/deployment/web")))
+	assert.NoError(t, preset.Access.Check("team-a-web.dev", workload("c/team-a-dev/deployment/web")))
+	assert.Error(t, preset.Access.Check("team-a-web.prod", workload("c/team-b/deployment/web")))
+	assert.Error(t, preset.Access.Check("team-b-web.prod", workload("c/team-a/deployment/web")))
+	// 没有任务名时，不能通过 --image 参数匹配 images
+	assert.Error(t, preset.Access.Check("", workload("c/team-a/deployment/web")))
+
+	assert.NoError(t, preset.Access.Check("ops-nginx.prod", workload("c/infra/deployment/ingress-nginx")))
+	err := preset.Access.Check("ops-nginx.prod", workload("c/infra/deployment/coredns"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops-nginx.prod")
+
+	assert.NoError(t, PresetAccess{}.Check("", workload("c/any/deployment/any")))
+}
+
+func TestAccessImage(t *testing.T) {
+	assert.Equal(t, "whoa", AccessImage("whoa.prod"))
+	assert.Equal(t, "", AccessImage("whoa"))
+	assert.Equal(t, "", AccessImage(""))
+}
+
+func TestCheckUniversalOwnership(t *testing.T) {
+	claim, err := CheckUniversalOwnership([]byte(`{"metadata":{}}`), "whoa")
+	require.NoError(t, err)
+	assert.True(t, claim)
+
+	claim, err = CheckUniversalOwnership([]byte(`{"metadata":{"annotations":{"net.guoyk.deployer/owner":"whoa"}}}`), "whoa")
+	require.NoError(t, err)
+	assert.False(t, claim)
+
+	_, err = CheckUniversalOwnership([]byte(`{"metadata":{"annotations":{"net.guoyk.deployer/owner":"other"}}}`), "whoa")
+	assert.Error(t, err)
+
+	preset := &Preset{Annotations: map[string]string{"a": "b"}}
+	p := UniversalPatch{}
+	p.Metadata.Annotations = preset.Annotations
+	p.ClaimOwnership("whoa")
+	assert.Equal(t, "whoa", p.Metadata.Annotations[AnnotationOwner])
+	assert.Equal(t, "b", p.Metadata.Annotations["a"])
+	assert.Len(t, preset.Annotations, 1)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UniversalAttachments 随工作负载一同部署的附属资源，在修改工作负载之前通过 kubectl apply 创建或者更新
+type UniversalAttachments struct {
+	ConfigMap               *corev1.ConfigMap
+	Secret                  *corev1.Secret
+	Service                 *corev1.Service
+	Ingress                 *networkingv1beta1.Ingress
+	HorizontalPodAutoscaler *autoscalingv2beta2.HorizontalPodAutoscaler
+	PodDisruptionBudget     *policyv1beta1.PodDisruptionBudget
+}
+
+func CreateUniversalAttachments(preset *Preset, profile *Profile, workload *UniversalWorkload) (a UniversalAttachments, err error) {
+	// 使用 --workload 参数中主容器 role 标签指定的角色
+	if profile, err = resolveUniversalRole(profile, workload.Primary().Labels.Role); err != nil {
+		return
+	}
+	if a.ConfigMap, err = CreateUniversalConfigMap(profile, workload); err != nil {
+		return
+	}
+	if a.Secret, err = CreateUniversalSecret(preset, profile, workload); err != nil {
+		return
+	}
+	if a.Service, err = CreateUniversalService(profile, workload); err != nil {
+		return
+	}
+	if a.Ingress, err = CreateUniversalIngress(preset, profile, workload); err != nil {
+		return
+	}
+	if a.HorizontalPodAutoscaler, err = CreateUniversalAutoscaler(profile, workload); err != nil {
+		return
+	}
+	if a.PodDisruptionBudget, err = CreateUniversalDisruptionBudget(profile, workload); err != nil {
+		return
+	}
+	return
+}
+
+// UseSelector 使用集群中工作负载自身的选择器选择 Pod，确保 Service 和中断预算在滚动更新期间仍然选中已经存在的 Pod
+// selector 为 nil (工作负载不存在) 时保持默认的 net.guoyk.deployer/workload 标签；Service 只支持 matchLabels
+func (a *UniversalAttachments) UseSelector(selector *metav1.LabelSelector) (err error) {
+	if selector == nil {
+		return
+	}
+	if a.Service != nil {
+		if len(selector.MatchExpressions) > 0 || len(selector.MatchLabels) == 0 {
+			err = errors.New("工作负载的选择器包含 matchExpressions，无法用作 Service " + a.Service.Name + " 的选择器")
+			return
+		}
+		a.Service.Spec.Selector = map[string]string{}
+		for k, v := range selector.MatchLabels {
+			a.Service.Spec.Selector[k] = v
+		}
+	}
+	if a.PodDisruptionBudget != nil {
+		a.PodDisruptionBudget.Spec.Selector = selector
+	}
+	return
+}
+
+// Objects 返回所有需要 kubectl apply 的资源
+func (a UniversalAttachments) Objects() (objs []interface{}) {
+	if a.ConfigMap != nil {
+		objs = append(objs, a.ConfigMap)
+	}
+	if a.Secret != nil {
+		objs = append(objs, a.Secret)
+	}
+	if a.Service != nil {
+		objs = append(objs, a.Service)
+	}
+	if a.Ingress != nil {
+		objs = append(objs, a.Ingress)
+	}
+	if a.HorizontalPodAutoscaler != nil {
+		objs = append(objs, a.HorizontalPodAutoscaler)
+	}
+	if a.PodDisruptionBudget != nil {
+		objs = append(objs, a.PodDisruptionBudget)
+	}
+	return
+}
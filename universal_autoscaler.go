@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// LabelAutoscalerOf 标记由 deployer2 创建的 HorizontalPodAutoscaler，值为工作负载名，用来在 autoscale 字段被删除后清理
+	LabelAutoscalerOf = "net.guoyk.deployer/autoscaler-of"
+)
+
+// ProfileAutoscale 自动伸缩配置，cpu 和 mem 为目标资源使用率，单位为百分比，相对于资源申请值
+type ProfileAutoscale struct {
+	Min int32 `yaml:"min"`
+	Max int32 `yaml:"max"`
+	CPU int32 `yaml:"cpu"`
+	MEM int32 `yaml:"mem"`
+}
+
+func autoscaleMetric(name corev1.ResourceName, utilization int32) autoscalingv2beta2.MetricSpec {
+	return autoscalingv2beta2.MetricSpec{
+		Type: autoscalingv2beta2.ResourceMetricSourceType,
+		Resource: &autoscalingv2beta2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2beta2.MetricTarget{
+				Type:               autoscalingv2beta2.UtilizationMetricType,
+				AverageUtilization: &utilization,
+			},
+		},
+	}
+}
+
+// CreateUniversalAutoscaler 从 Profile 的 autoscale 字段创建 HorizontalPodAutoscaler，如果没有设置 autoscale 字段则返回 nil
+func CreateUniversalAutoscaler(profile *Profile, workload *UniversalWorkload) (hpa *autoscalingv2beta2.HorizontalPodAutoscaler, err error) {
+	if profile.Autoscale == nil {
+		return
+	}
+	a := *profile.Autoscale
+	if !workload.IsScalable() {
+		err = errors.New("autoscale 字段仅支持 deployment 和 statefulset 类型的工作负载")
+		return
+	}
+	if a.Max <= 0 {
+		err = errors.New("autoscale 字段缺少 max")
+		return
+	}
+	if a.Min <= 0 {
+		a.Min = 1
+	}
+	if a.Min > a.Max {
+		err = errors.New("autoscale 字段中 min 不能大于 max")
+		return
+	}
+	if a.CPU <= 0 && a.MEM <= 0 {
+		err = errors.New("autoscale 字段至少需要设置 cpu 或 mem 使用率")
+		return
+	}
+	hpa = &autoscalingv2beta2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name,
+			Namespace: workload.Namespace,
+			Labels: map[string]string{
+				LabelAutoscalerOf: workload.Name,
+			},
+		},
+		Spec: autoscalingv2beta2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       workload.Kind(),
+				Name:       workload.Name,
+			},
+			MinReplicas: &a.Min,
+			MaxReplicas: a.Max,
+		},
+	}
+	if a.CPU > 0 {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscaleMetric(corev1.ResourceCPU, a.CPU))
+	}
+	if a.MEM > 0 {
+		hpa.Spec.Metrics = append(hpa.Spec.Metrics, autoscaleMetric(corev1.ResourceMemory, a.MEM))
+	}
+	return
+}
+
+// ExpiredUniversalAutoscalers 在未设置 autoscale 字段时，找出 deployer2 为指定工作负载创建的 HorizontalPodAutoscaler，返回需要删除的名称和其余条目
+func ExpiredUniversalAutoscalers(items []autoscalingv2beta2.HorizontalPodAutoscaler, workload *UniversalWorkload) (expired []string, rest []autoscalingv2beta2.HorizontalPodAutoscaler) {
+	for _, item := range items {
+		ref := item.Spec.ScaleTargetRef
+		if item.Labels[LabelAutoscalerOf] == workload.Name && ref.Kind == workload.Kind() && ref.Name == workload.Name {
+			expired = append(expired, item.Name)
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	return
+}
+
+// HasUniversalAutoscaler 判断 HorizontalPodAutoscaler 列表中是否存在以指定工作负载为目标的条目
+func HasUniversalAutoscaler(items []autoscalingv2beta2.HorizontalPodAutoscaler, workload *UniversalWorkload) bool {
+	for _, item := range items {
+		ref := item.Spec.ScaleTargetRef
+		if ref.Kind == workload.Kind() && ref.Name == workload.Name {
+			return true
+		}
+	}
+	return false
+}
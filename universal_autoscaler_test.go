@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"testing"
+)
+
+func TestCreateUniversalAutoscaler(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deploy/whoa"))
+
+	hpa, err := CreateUniversalAutoscaler(&Profile{}, workload)
+	require.NoError(t, err)
+	assert.Nil(t, hpa)
+
+	profile := &Profile{Autoscale: &ProfileAutoscale{Max: 5, CPU: 80}}
+	hpa, err = CreateUniversalAutoscaler(profile, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "whoa", hpa.Name)
+	assert.Equal(t, "Deployment", hpa.Spec.ScaleTargetRef.Kind)
+	assert.Equal(t, int32(1), *hpa.Spec.MinReplicas)
+	assert.Equal(t, int32(5), hpa.Spec.MaxReplicas)
+	require.Len(t, hpa.Spec.Metrics, 1)
+	assert.Equal(t, int32(80), *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization)
+
+	assert.True(t, HasUniversalAutoscaler([]autoscalingv2beta2.HorizontalPodAutoscaler{*hpa}, workload))
+	other := &UniversalWorkload{}
+	require.NoError(t, other.Set("test-cluster/test-ns/sts/whoa"))
+	assert.False(t, HasUniversalAutoscaler([]autoscalingv2beta2.HorizontalPodAutoscaler{*hpa}, other))
+
+	profile.Autoscale.CPU = 0
+	_, err = CreateUniversalAutoscaler(profile, workload)
+	assert.Error(t, err)
+
+	profile.Autoscale.MEM = 70
+	profile.Autoscale.Min = 6
+	_, err = CreateUniversalAutoscaler(profile, workload)
+	assert.Error(t, err)
+
+	require.NoError(t, other.Set("test-cluster/test-ns/ds/whoa"))
+	profile.Autoscale.Min = 2
+	_, err = CreateUniversalAutoscaler(profile, other)
+	assert.Error(t, err)
+}
+
+func TestExpiredUniversalAutoscalers(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deploy/whoa"))
+	hpa, err := CreateUniversalAutoscaler(&Profile{Autoscale: &ProfileAutoscale{Max: 5, CPU: 80}}, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "whoa", hpa.Labels[LabelAutoscalerOf])
+
+	// 手动创建的 HorizontalPodAutoscaler 不会被删除
+	manual := hpa.DeepCopy()
+	manual.Name, manual.Labels = "whoa-manual", nil
+	expired, rest := ExpiredUniversalAutoscalers([]autoscalingv2beta2.HorizontalPodAutoscaler{*hpa, *manual}, workload)
+	assert.Equal(t, []string{"whoa"}, expired)
+	require.Len(t, rest, 1)
+	assert.Equal(t, "whoa-manual", rest[0].Name)
+	assert.True(t, HasUniversalAutoscaler(rest, workload))
+
+	expired, rest = ExpiredUniversalAutoscalers([]autoscalingv2beta2.HorizontalPodAutoscaler{*hpa}, workload)
+	assert.Equal(t, []string{"whoa"}, expired)
+	assert.False(t, HasUniversalAutoscaler(rest, workload))
+}
+
+func TestCreateUniversalPatch_Replicas(t *testing.T) {
+	replicas := int32(3)
+	profile := &Profile{Replicas: &replicas}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *p.Spec.Replicas)
+
+	attachments := &UniversalAttachments{HorizontalPodAutoscaler: &autoscalingv2beta2.HorizontalPodAutoscaler{}}
+	p, err = CreateUniversalPatch(&Preset{}, profile, workload, attachments, "whoa:dev")
+	require.NoError(t, err)
+	assert.Nil(t, p.Spec.Replicas)
+
+	require.NoError(t, workload.Set("test-cluster/test-ns/daemonset/whoa"))
+	_, err = CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"errors"
 	"github.com/imdario/mergo"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+	"strconv"
 )
 
 var (
+	defaultUniversalCheckDelay = 60
+
 	defaultUniversalCheck = UniversalCheck{
 		Port:     8080,
-		Delay:    60,
+		Delay:    &defaultUniversalCheckDelay,
 		Interval: 15,
 		Success:  1,
 		Failure:  2,
@@ -17,43 +22,206 @@ var (
 	}
 )
 
+const (
+	CheckTypeHTTP  = "http"
+	CheckTypeHTTPS = "https"
+	CheckTypeTCP   = "tcp"
+	CheckTypeExec  = "exec"
+	CheckTypeGRPC  = "grpc"
+
+	// GRPCHealthProbe gRPC 健康检查使用的命令，需要镜像内包含 grpc_health_probe
+	GRPCHealthProbe = "grpc_health_probe"
+)
+
+// UniversalCheck 健康检查，delay 为指针，以便显式设置为 0
 type UniversalCheck struct {
-	Port     int    `yaml:"port"`
-	Path     string `yaml:"path"`
-	Delay    int    `yaml:"delay"`
-	Interval int    `yaml:"interval"`
-	Success  int    `yaml:"success"`
-	Failure  int    `yaml:"failure"`
-	Timeout  int    `yaml:"timeout"`
+	Type     string            `yaml:"type"`
+	Port     int               `yaml:"port"`
+	Path     string            `yaml:"path"`
+	Host     string            `yaml:"host"`
+	Headers  map[string]string `yaml:"headers"`
+	Command  []string          `yaml:"command"`
+	Service  string            `yaml:"service"`
+	Delay    *int              `yaml:"delay"`
+	Interval int               `yaml:"interval"`
+	Success  int               `yaml:"success"`
+	Failure  int               `yaml:"failure"`
+	Timeout  int               `yaml:"timeout"`
+
+	// 独立的探针配置，缺失的字段从上述共享配置中继承
+	Liveness  *UniversalCheck `yaml:"liveness"`
+	Readiness *UniversalCheck `yaml:"readiness"`
+	Startup   *UniversalCheck `yaml:"startup"`
 }
 
-func (c UniversalCheck) GenerateReadinessProbe() *corev1.Probe {
-	_ = mergo.Merge(&c, defaultUniversalCheck)
-	if c.Path == "" {
+// Merge 使用 base 补全 c 中未设置的字段，liveness, readiness 和 startup 分别合并，返回新的配置，不修改 c 和 base
+// mergo 会把指向 0 的指针视为未设置并修改其指向的值，因此 delay 单独处理，以便显式设置为 0
+func (c UniversalCheck) Merge(base UniversalCheck) UniversalCheck {
+	out := c
+	delay := c.Delay
+	if delay == nil {
+		delay = base.Delay
+	}
+	// 复制 headers，避免合并时修改原有配置
+	if c.Headers != nil {
+		out.Headers = map[string]string{}
+		for k, v := range c.Headers {
+			out.Headers[k] = v
+		}
+	}
+	liveness := mergeUniversalProbe(c.Liveness, base.Liveness)
+	readiness := mergeUniversalProbe(c.Readiness, base.Readiness)
+	startup := mergeUniversalProbe(c.Startup, base.Startup)
+	out.Delay, out.Liveness, out.Readiness, out.Startup = nil, nil, nil, nil
+	base.Delay, base.Liveness, base.Readiness, base.Startup = nil, nil, nil, nil
+	_ = mergo.Merge(&out, base)
+	out.Delay, out.Liveness, out.Readiness, out.Startup = delay, liveness, readiness, startup
+	return out
+}
+
+func mergeUniversalProbe(probe *UniversalCheck, base *UniversalCheck) *UniversalCheck {
+	if probe == nil {
+		return base
+	}
+	if base == nil {
+		return probe
+	}
+	out := probe.Merge(*base)
+	return &out
+}
+
+// Resolve 返回指定探针的最终配置，优先使用探针自身的设置，其次是共享配置，最后是 defaultUniversalCheck
+func (c UniversalCheck) Resolve(probe *UniversalCheck) UniversalCheck {
+	shared := c
+	shared.Liveness, shared.Readiness, shared.Startup = nil, nil, nil
+	out := shared
+	if probe != nil {
+		out = probe.Merge(shared)
+		out.Liveness, out.Readiness, out.Startup = nil, nil, nil
+	}
+	return out.Merge(defaultUniversalCheck)
+}
+
+func (c UniversalCheck) Validate() (err error) {
+	for _, probe := range []*UniversalCheck{c.Liveness, c.Readiness, c.Startup} {
+		if err = c.Resolve(probe).validate(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c UniversalCheck) validate() error {
+	switch c.Type {
+	case "", CheckTypeHTTP, CheckTypeHTTPS, CheckTypeTCP, CheckTypeGRPC:
+		return nil
+	case CheckTypeExec:
+		if len(c.Command) == 0 {
+			return errors.New("健康检查类型为 exec 时，必须设置 command")
+		}
+		return nil
+	default:
+		return errors.New("未知的健康检查类型: " + c.Type)
+	}
+}
+
+func (c UniversalCheck) GenerateHandler() *corev1.Handler {
+	switch c.Type {
+	case "", CheckTypeHTTP, CheckTypeHTTPS:
+		// HTTP 健康检查，如果没有设置路径，则关闭健康检查
+		if c.Path == "" {
+			return nil
+		}
+		scheme := corev1.URISchemeHTTP
+		if c.Type == CheckTypeHTTPS {
+			scheme = corev1.URISchemeHTTPS
+		}
+		action := &corev1.HTTPGetAction{
+			Path:   c.Path,
+			Port:   intstr.FromInt(c.Port),
+			Host:   c.Host,
+			Scheme: scheme,
+		}
+		var names []string
+		for name := range c.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			action.HTTPHeaders = append(action.HTTPHeaders, corev1.HTTPHeader{Name: name, Value: c.Headers[name]})
+		}
+		return &corev1.Handler{HTTPGet: action}
+	case CheckTypeTCP:
+		return &corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(c.Port),
+				Host: c.Host,
+			},
+		}
+	case CheckTypeExec:
+		if len(c.Command) == 0 {
+			return nil
+		}
+		return &corev1.Handler{
+			Exec: &corev1.ExecAction{Command: c.Command},
+		}
+	case CheckTypeGRPC:
+		// 当前版本的 Kubernetes 不支持原生 gRPC 健康检查，使用 grpc_health_probe 命令
+		command := []string{GRPCHealthProbe, "-addr=:" + strconv.Itoa(c.Port)}
+		if c.Service != "" {
+			command = append(command, "-service="+c.Service)
+		}
+		return &corev1.Handler{
+			Exec: &corev1.ExecAction{Command: command},
+		}
+	default:
+		return nil
+	}
+}
+
+func (c UniversalCheck) generateProbe() *corev1.Probe {
+	h := c.GenerateHandler()
+	if h == nil {
 		return nil
 	}
 	b := &corev1.Probe{
-		InitialDelaySeconds: int32(c.Delay),
+		InitialDelaySeconds: int32(*c.Delay),
 		TimeoutSeconds:      int32(c.Timeout),
 		PeriodSeconds:       int32(c.Interval),
 		SuccessThreshold:    int32(c.Success),
 		FailureThreshold:    int32(c.Failure),
-		Handler: corev1.Handler{
-			HTTPGet: &corev1.HTTPGetAction{
-				Path:   c.Path,
-				Port:   intstr.FromInt(c.Port),
-				Scheme: "HTTP",
-			},
-		},
+		Handler:             *h,
 	}
 	return b
 }
 
+func (c UniversalCheck) GenerateReadinessProbe() *corev1.Probe {
+	return c.Resolve(c.Readiness).generateProbe()
+}
+
 func (c UniversalCheck) GenerateLivenessProbe() *corev1.Probe {
-	p := c.GenerateReadinessProbe()
+	p := c.Resolve(c.Liveness).generateProbe()
 	if p != nil {
 		// LivenessProbe 强制要求 SuccessThreshold = 1
 		p.SuccessThreshold = 1
 	}
 	return p
 }
+
+// GenerateStartupProbe 只有设置了 startup 字段时，才会生成 StartupProbe
+// 启动探针本身用来等待启动完成，startup 和共享配置都没有设置 delay 时，立即开始检查
+func (c UniversalCheck) GenerateStartupProbe() *corev1.Probe {
+	if c.Startup == nil {
+		return nil
+	}
+	r := c.Resolve(c.Startup)
+	if c.Startup.Delay == nil && c.Delay == nil {
+		r.Delay = new(int)
+	}
+	p := r.generateProbe()
+	if p != nil {
+		// StartupProbe 强制要求 SuccessThreshold = 1
+		p.SuccessThreshold = 1
+	}
+	return p
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUniversalCheck_GenerateReadinessProbe(t *testing.T) {
+	p := UniversalCheck{}.GenerateReadinessProbe()
+	assert.Nil(t, p)
+
+	p = UniversalCheck{
+		Type:    CheckTypeHTTPS,
+		Path:    "/healthz",
+		Host:    "example.com",
+		Headers: map[string]string{"X-B": "2", "X-A": "1"},
+	}.GenerateReadinessProbe()
+	require.NotNil(t, p)
+	assert.Equal(t, "HTTPS", string(p.HTTPGet.Scheme))
+	assert.Equal(t, 8080, p.HTTPGet.Port.IntValue())
+	assert.Equal(t, "example.com", p.HTTPGet.Host)
+	require.Len(t, p.HTTPGet.HTTPHeaders, 2)
+	assert.Equal(t, "X-A", p.HTTPGet.HTTPHeaders[0].Name)
+	assert.Equal(t, int32(60), p.InitialDelaySeconds)
+
+	p = UniversalCheck{Type: CheckTypeTCP, Port: 6379}.GenerateReadinessProbe()
+	require.NotNil(t, p)
+	assert.Equal(t, 6379, p.TCPSocket.Port.IntValue())
+
+	p = UniversalCheck{Type: CheckTypeExec, Command: []string{"redis-cli", "ping"}}.GenerateReadinessProbe()
+	require.NotNil(t, p)
+	assert.Equal(t, []string{"redis-cli", "ping"}, p.Exec.Command)
+
+	p = UniversalCheck{Type: CheckTypeGRPC, Port: 9000, Service: "app"}.GenerateReadinessProbe()
+	require.NotNil(t, p)
+	assert.Equal(t, []string{GRPCHealthProbe, "-addr=:9000", "-service=app"}, p.Exec.Command)
+
+	p = UniversalCheck{Type: CheckTypeTCP, Success: 3}.GenerateLivenessProbe()
+	require.NotNil(t, p)
+	assert.Equal(t, int32(1), p.SuccessThreshold)
+}
+
+func TestUniversalCheck_Validate(t *testing.T) {
+	assert.NoError(t, UniversalCheck{}.Validate())
+	assert.NoError(t, UniversalCheck{Type: CheckTypeGRPC}.Validate())
+	assert.Error(t, UniversalCheck{Type: CheckTypeExec}.Validate())
+	assert.Error(t, UniversalCheck{Type: "udp"}.Validate())
+}
+
+func TestUniversalCheck_IndependentProbes(t *testing.T) {
+	c := UniversalCheck{
+		Port:    8080,
+		Path:    "/ready",
+		Headers: map[string]string{"X-A": "1"},
+		Liveness: &UniversalCheck{
+			Path:    "/live",
+			Delay:   intPtr(120),
+			Headers: map[string]string{"X-B": "2"},
+		},
+		Startup: &UniversalCheck{
+			Type:     CheckTypeTCP,
+			Interval: 5,
+			Failure:  60,
+		},
+	}
+	assert.NoError(t, c.Validate())
+
+	r := c.GenerateReadinessProbe()
+	require.NotNil(t, r)
+	assert.Equal(t, "/ready", r.HTTPGet.Path)
+	assert.Equal(t, int32(60), r.InitialDelaySeconds)
+
+	l := c.GenerateLivenessProbe()
+	require.NotNil(t, l)
+	assert.Equal(t, "/live", l.HTTPGet.Path)
+	assert.Equal(t, 8080, l.HTTPGet.Port.IntValue())
+	assert.Equal(t, int32(120), l.InitialDelaySeconds)
+	assert.Len(t, l.HTTPGet.HTTPHeaders, 2)
+	assert.Len(t, c.Liveness.Headers, 1)
+
+	s := c.GenerateStartupProbe()
+	require.NotNil(t, s)
+	assert.Equal(t, 8080, s.TCPSocket.Port.IntValue())
+	assert.Equal(t, int32(5), s.PeriodSeconds)
+	assert.Equal(t, int32(60), s.FailureThreshold)
+	assert.Equal(t, int32(1), s.SuccessThreshold)
+
+	c.Startup = nil
+	assert.Nil(t, c.GenerateStartupProbe())
+
+	c.Readiness = &UniversalCheck{Type: CheckTypeExec}
+	assert.Error(t, c.Validate())
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestUniversalCheck_ZeroDelay(t *testing.T) {
+	c := UniversalCheck{
+		Path:     "/healthz",
+		Liveness: &UniversalCheck{Delay: intPtr(0)},
+		Startup:  &UniversalCheck{Failure: 30},
+	}
+	assert.Equal(t, int32(0), c.GenerateLivenessProbe().InitialDelaySeconds)
+	assert.Equal(t, int32(60), c.GenerateReadinessProbe().InitialDelaySeconds)
+	assert.Equal(t, 0, *c.Liveness.Delay)
+
+	// 启动探针未设置 delay 时立即开始检查
+	assert.Equal(t, int32(0), c.GenerateStartupProbe().InitialDelaySeconds)
+
+	// 共享配置中的 delay: 0
+	c.Delay = intPtr(0)
+	assert.Equal(t, int32(0), c.GenerateReadinessProbe().InitialDelaySeconds)
+	c.Delay = intPtr(30)
+	assert.Equal(t, int32(30), c.GenerateStartupProbe().InitialDelaySeconds)
+	c.Startup.Delay = intPtr(0)
+	assert.Equal(t, int32(0), c.GenerateStartupProbe().InitialDelaySeconds)
+	assert.Equal(t, 30, *c.Delay)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	ConfigMapVolumeName = "deployer-config"
+	ConfigMapKeep       = 5
+
+	LabelConfigOf       = "net.guoyk.deployer/config-of"
+	AnnotationTimestamp = "net.guoyk.deployer/timestamp"
+)
+
+type ProfileConfigFile struct {
+	Path     string `yaml:"path"`
+	Key      string `yaml:"key"`
+	Template bool   `yaml:"template"`
+}
+
+// ProfileConfig 配置文件，会被打包为带有内容哈希后缀的 ConfigMap，并挂载到容器内
+type ProfileConfig struct {
+	MountPath string              `yaml:"mountPath"`
+	Keep      int                 `yaml:"keep"`
+	Files     []ProfileConfigFile `yaml:"files"`
+}
+
+// CreateUniversalConfigMap 从 Profile 的 config 字段创建 ConfigMap，内容相同则名称相同，如果没有配置文件则返回 nil
+func CreateUniversalConfigMap(profile *Profile, workload *UniversalWorkload) (cm *corev1.ConfigMap, err error) {
+	if len(profile.Config.Files) == 0 {
+		return
+	}
+	if profile.Config.MountPath == "" {
+		err = errors.New("config 字段缺少 mountPath")
+		return
+	}
+	data := map[string]string{}
+	for _, file := range profile.Config.Files {
+		key := file.Key
+		if key == "" {
+			key = filepath.Base(file.Path)
+		}
+		if _, found := data[key]; found {
+			err = errors.New("config 字段中存在重复的文件名: " + key)
+			return
+		}
+		// 相对路径以描述文件所在的目录为基准
+		filename := file.Path
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(profile.Dir, filename)
+		}
+		var buf []byte
+		if buf, err = ioutil.ReadFile(filename); err != nil {
+			return
+		}
+		if file.Template {
+			if buf, err = profile.Render(string(buf)); err != nil {
+				return
+			}
+		}
+		data[key] = string(buf)
+	}
+	cm = &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name + "-config-" + hashConfigMapData(data),
+			Namespace: workload.Namespace,
+			Labels: map[string]string{
+				LabelConfigOf: workload.Name,
+			},
+			Annotations: map[string]string{
+				AnnotationTimestamp: time.Now().Format(time.RFC3339),
+			},
+		},
+		Data: data,
+	}
+	return
+}
+
+func hashConfigMapData(data map[string]string) string {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:10]
+}
+
+// ExpiredUniversalConfigMaps 按照部署时间排序，返回超出保留数量的旧 ConfigMap 名称，当前使用的 ConfigMap 永远不会被返回
+func ExpiredUniversalConfigMaps(items []corev1.ConfigMap, current string, keep int) (names []string) {
+	if keep <= 0 {
+		keep = ConfigMapKeep
+	}
+	// 排序副本，不修改调用方的切片
+	items = append([]corev1.ConfigMap{}, items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Annotations[AnnotationTimestamp] > items[j].Annotations[AnnotationTimestamp]
+	})
+	// 当前 ConfigMap 占用一个保留名额
+	keep--
+	for _, item := range items {
+		if item.Name == current {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		names = append(names, item.Name)
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateUniversalConfigMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deployer-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.yml"), []byte("env: {{.Vars.env}}"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "raw.txt"), []byte("{{.Vars.env}}"), 0644))
+
+	p := &Profile{
+		Vars: map[string]interface{}{"env": "test"},
+		Config: ProfileConfig{
+			MountPath: "/etc/app",
+			Files: []ProfileConfigFile{
+				{Path: filepath.Join(dir, "app.yml"), Template: true},
+				{Path: filepath.Join(dir, "raw.txt"), Key: "other.txt"},
+			},
+		},
+	}
+	w := &UniversalWorkload{Namespace: "test-ns", Name: "whoa"}
+	cm1, err := CreateUniversalConfigMap(p, w)
+	require.NoError(t, err)
+	assert.Equal(t, "env: test", cm1.Data["app.yml"])
+	assert.Equal(t, "{{.Vars.env}}", cm1.Data["other.txt"])
+	assert.Equal(t, "whoa", cm1.Labels[LabelConfigOf])
+	assert.Equal(t, "test-ns", cm1.Namespace)
+
+	cm2, err := CreateUniversalConfigMap(p, w)
+	require.NoError(t, err)
+	assert.Equal(t, cm1.Name, cm2.Name)
+
+	// 相对路径以描述文件所在的目录为基准
+	p.Dir = dir
+	p.Config.Files = []ProfileConfigFile{{Path: "app.yml", Template: true}, {Path: "raw.txt", Key: "other.txt"}}
+	cm2, err = CreateUniversalConfigMap(p, w)
+	require.NoError(t, err)
+	assert.Equal(t, cm1.Name, cm2.Name)
+
+	p.Vars["env"] = "prod"
+	cm3, err := CreateUniversalConfigMap(p, w)
+	require.NoError(t, err)
+	assert.NotEqual(t, cm1.Name, cm3.Name)
+
+	p.Config.Files = nil
+	cm4, err := CreateUniversalConfigMap(p, w)
+	require.NoError(t, err)
+	assert.Nil(t, cm4)
+}
+
+func TestExpiredUniversalConfigMaps(t *testing.T) {
+	item := func(name, ts string) corev1.ConfigMap {
+		return corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{AnnotationTimestamp: ts},
+		}}
+	}
+	items := []corev1.ConfigMap{
+		item("a", "2020-01-01T00:00:00Z"),
+		item("b", "2020-01-04T00:00:00Z"),
+		item("c", "2020-01-02T00:00:00Z"),
+		item("d", "2020-01-03T00:00:00Z"),
+	}
+	assert.Equal(t, []string{"c", "a"}, ExpiredUniversalConfigMaps(items, "b", 2))
+	assert.Equal(t, []string{"b", "d", "c"}, ExpiredUniversalConfigMaps(items, "a", 1))
+	assert.Empty(t, ExpiredUniversalConfigMaps(items, "a", 0))
+	// 不修改调用方的切片
+	assert.Equal(t, "a", items[0].Name)
+	assert.Equal(t, "b", items[1].Name)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"regexp"
+	"strings"
+)
+
+var (
+	regexpDisruptionPercent = regexp.MustCompile(`^[0-9]+%$`)
+)
+
+// ProfileDisruption 中断预算，minAvailable 和 maxUnavailable 只能设置一个，可以是整数或者百分比
+type ProfileDisruption struct {
+	MinAvailable   string `yaml:"minAvailable"`
+	MaxUnavailable string `yaml:"maxUnavailable"`
+}
+
+// CreateUniversalDisruptionBudget 从 Profile 的 disruption 字段创建 PodDisruptionBudget，如果没有设置 disruption 字段则返回 nil
+// 选择器默认为 deployer2 添加到 Pod 上的标签，部署时会使用 ParseUniversalSelector 替换为工作负载自身的选择器
+func CreateUniversalDisruptionBudget(profile *Profile, workload *UniversalWorkload) (pdb *policyv1beta1.PodDisruptionBudget, err error) {
+	d := profile.Disruption
+	if d == nil {
+		return
+	}
+	if (d.MinAvailable == "") == (d.MaxUnavailable == "") {
+		err = errors.New("disruption 字段必须设置且只能设置 minAvailable 和 maxUnavailable 中的一个")
+		return
+	}
+	pdb = &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name,
+			Namespace: workload.Namespace,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{LabelWorkload: workload.Name},
+			},
+		},
+	}
+	if d.MinAvailable != "" {
+		if pdb.Spec.MinAvailable, err = parseDisruptionValue("minAvailable", d.MinAvailable); err != nil {
+			return
+		}
+	} else {
+		if pdb.Spec.MaxUnavailable, err = parseDisruptionValue("maxUnavailable", d.MaxUnavailable); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ParseUniversalSelector 从工作负载的 JSON 中读取 spec.selector，工作负载没有选择器 (比如 cronjob) 时返回 nil
+func ParseUniversalSelector(buf []byte) (selector *metav1.LabelSelector, err error) {
+	var obj struct {
+		Spec struct {
+			Selector *metav1.LabelSelector `json:"selector"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(buf, &obj); err != nil {
+		return
+	}
+	if s := obj.Spec.Selector; s != nil && (len(s.MatchLabels) > 0 || len(s.MatchExpressions) > 0) {
+		selector = s
+	}
+	return
+}
+
+func parseDisruptionValue(field, s string) (v *intstr.IntOrString, err error) {
+	p := intstr.Parse(strings.TrimSpace(s))
+	if (p.Type == intstr.Int && p.IntVal < 0) ||
+		(p.Type == intstr.String && !regexpDisruptionPercent.MatchString(p.StrVal)) {
+		err = errors.New("disruption." + field + " 格式不正确，需要为非负整数或者百分比: " + s)
+		return
+	}
+	v = &p
+	return
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCreateUniversalDisruptionBudget(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	pdb, err := CreateUniversalDisruptionBudget(&Profile{}, workload)
+	require.NoError(t, err)
+	assert.Nil(t, pdb)
+
+	pdb, err = CreateUniversalDisruptionBudget(&Profile{Disruption: &ProfileDisruption{MinAvailable: "1"}}, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "whoa", pdb.Name)
+	assert.Equal(t, "whoa", pdb.Spec.Selector.MatchLabels[LabelWorkload])
+	assert.Equal(t, 1, pdb.Spec.MinAvailable.IntValue())
+	assert.Nil(t, pdb.Spec.MaxUnavailable)
+
+	pdb, err = CreateUniversalDisruptionBudget(&Profile{Disruption: &ProfileDisruption{MaxUnavailable: "25%"}}, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "25%", pdb.Spec.MaxUnavailable.String())
+
+	_, err = CreateUniversalDisruptionBudget(&Profile{Disruption: &ProfileDisruption{}}, workload)
+	assert.Error(t, err)
+	_, err = CreateUniversalDisruptionBudget(&Profile{Disruption: &ProfileDisruption{MinAvailable: "1", MaxUnavailable: "1"}}, workload)
+	assert.Error(t, err)
+	_, err = CreateUniversalDisruptionBudget(&Profile{Disruption: &ProfileDisruption{MinAvailable: "half"}}, workload)
+	assert.Error(t, err)
+}
+
+func TestParseUniversalSelector(t *testing.T) {
+	selector, err := ParseUniversalSelector([]byte(`{"spec":{"selector":{"matchLabels":{"app":"whoa"}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "whoa"}, selector.MatchLabels)
+
+	selector, err = ParseUniversalSelector([]byte(`{"spec":{"schedule":"* * * * *"}}`))
+	require.NoError(t, err)
+	assert.Nil(t, selector)
+}
@@ -1,84 +1,546 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+	"sort"
 	"strings"
 	"time"
 )
 
 type UniversalPatch struct {
+	// PrunedContainers 需要从 Pod 模板中删除的容器名，序列化时生成 $patch: delete 指令
+	PrunedContainers []string `json:"-"`
+	// PrunedVolumes 需要从 Pod 模板中删除的卷名，序列化时生成 $patch: delete 指令
+	PrunedVolumes []string `json:"-"`
+	// PrunedVolumeMounts 按容器名记录需要删除的挂载路径，序列化时生成 $patch: delete 指令
+	PrunedVolumeMounts map[string][]string `json:"-"`
+	// UnlimitedResources 按容器名记录无限制的资源，序列化时将其限制值设置为 null，删除工作负载中已有的限制值
+	UnlimitedResources map[string][]corev1.ResourceName `json:"-"`
+
 	Metadata struct {
 		Annotations map[string]string `json:"annotations,omitempty"`
 	} `json:"metadata,omitempty"`
 	Spec struct {
+		Replicas *int32 `json:"replicas,omitempty"`
 		Template struct {
 			Metadata struct {
+				Labels      map[string]string `json:"labels,omitempty"`
 				Annotations map[string]string `json:"annotations,omitempty"`
 			} `json:"metadata,omitempty"`
 			Spec struct {
-				ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
-				InitContainers   []corev1.Container            `json:"initContainers,omitempty"`
-				Containers       []corev1.Container            `json:"containers,omitempty"`
+				ServiceAccountName            string                            `json:"serviceAccountName,omitempty"`
+				SecurityContext               *corev1.PodSecurityContext        `json:"securityContext,omitempty"`
+				ImagePullSecrets              []corev1.LocalObjectReference     `json:"imagePullSecrets,omitempty"`
+				NodeSelector                  map[string]string                 `json:"nodeSelector,omitempty"`
+				Tolerations                   []corev1.Toleration               `json:"tolerations,omitempty"`
+				Affinity                      *corev1.Affinity                  `json:"affinity,omitempty"`
+				TopologySpreadConstraints     []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+				TerminationGracePeriodSeconds *int64                            `json:"terminationGracePeriodSeconds,omitempty"`
+				Volumes                       []corev1.Volume                   `json:"volumes,omitempty"`
+				InitContainers                []corev1.Container                `json:"initContainers,omitempty"`
+				Containers                    []corev1.Container                `json:"containers,omitempty"`
 			} `json:"spec,omitempty"`
 		} `json:"template,omitempty"`
 	} `json:"spec,omitempty"`
+
+	// managedContainers 使用环境配置生成完整配置的容器名，包括边车容器
+	managedContainers map[string]bool
 }
 
-func CreateUniversalPatch(preset *Preset, profile *Profile, workload *UniversalWorkload, imageName string) UniversalPatch {
-	var p UniversalPatch
+// resolveUniversalRole 返回指定角色覆盖后的环境配置，未指定角色时返回原环境配置
+func resolveUniversalRole(profile *Profile, role string) (out *Profile, err error) {
+	if role == "" {
+		out = profile
+		return
+	}
+	var rp Profile
+	if rp, err = profile.Role(role); err != nil {
+		return
+	}
+	out = &rp
+	return
+}
+
+func CreateUniversalPatch(preset *Preset, profile *Profile, workload *UniversalWorkload, attachments *UniversalAttachments, imageName string) (p UniversalPatch, err error) {
+	base := profile
+	// Pod 级别的配置使用主容器 role 标签指定的角色
+	if profile, err = resolveUniversalRole(base, workload.Primary().Labels.Role); err != nil {
+		return
+	}
 	p.Metadata.Annotations = preset.Annotations
-	p.Spec.Template.Metadata.Annotations = map[string]string{
-		"net.guoyk.deployer/timestamp": time.Now().Format(time.RFC3339),
+	// Pod 级别配置，集群预置文件中的值优先
+	pod := preset.UniversalPod.Enforce(profile.UniversalPod)
+	if p.Spec.Template.Metadata.Labels, err = pod.GenerateLabels(profile.Render); err != nil {
+		return
+	}
+	p.Spec.Template.Metadata.Labels[LabelWorkload] = workload.Name
+	if p.Spec.Template.Metadata.Annotations, err = pod.GenerateAnnotations(profile.Render); err != nil {
+		return
+	}
+	p.Spec.Template.Metadata.Annotations[AnnotationTimestamp] = time.Now().Format(time.RFC3339)
+	p.Spec.Template.Spec.ServiceAccountName = pod.ServiceAccountName
+	p.Spec.Template.Spec.SecurityContext = pod.GenerateSecurityContext()
+	var securityContext *corev1.SecurityContext
+	if securityContext, err = pod.GenerateContainerSecurityContext(); err != nil {
+		return
+	}
+	// 存在 HorizontalPodAutoscaler 时，不设置副本数，避免与自动伸缩冲突
+	if profile.Replicas != nil {
+		if !workload.IsScalable() {
+			err = errors.New("replicas 字段仅支持 deployment 和 statefulset 类型的工作负载")
+			return
+		}
+		if attachments.HorizontalPodAutoscaler == nil {
+			p.Spec.Replicas = profile.Replicas
+		} else {
+			log.Println("已设置 autoscale 字段，忽略 replicas 字段")
+		}
 	}
 	for _, name := range preset.ImagePullSecrets {
 		secret := corev1.LocalObjectReference{Name: strings.TrimSpace(name)}
 		p.Spec.Template.Spec.ImagePullSecrets = append(p.Spec.Template.Spec.ImagePullSecrets, secret)
 	}
-	if workload.Labels.Init {
-		container := corev1.Container{
-			Image:           imageName,
-			Name:            workload.Container,
-			ImagePullPolicy: "Always",
+	// 调度约束，按照 preset → default → 环境 的顺序合并
+	scheduling := preset.UniversalScheduling.Override(profile.UniversalScheduling)
+	p.Spec.Template.Spec.NodeSelector = scheduling.NodeSelector
+	p.Spec.Template.Spec.Tolerations = scheduling.GenerateTolerations()
+	if p.Spec.Template.Spec.Affinity, err = scheduling.GenerateAffinity(workload); err != nil {
+		return
+	}
+	if p.Spec.Template.Spec.TopologySpreadConstraints, err = scheduling.GenerateTopologySpreadConstraints(workload); err != nil {
+		return
+	}
+	var managed bool
+	for _, c := range workload.Containers() {
+		var cp *Profile
+		if cp, err = resolveUniversalRole(base, c.Labels.Role); err != nil {
+			return
+		}
+		var container corev1.Container
+		var unlimited []corev1.ResourceName
+		if container, unlimited, err = createUniversalContainer(preset, cp, c, attachments, imageName); err != nil {
+			return
+		}
+		p.addUnlimitedResources(container.Name, unlimited)
+		// 只更新镜像的初始化容器不设置安全上下文
+		if isManagedUniversalContainer(c) {
+			container.SecurityContext = securityContext
+		}
+		if c.Labels.Init {
+			p.Spec.Template.Spec.InitContainers = append(p.Spec.Template.Spec.InitContainers, container)
+		} else {
+			p.Spec.Template.Spec.Containers = append(p.Spec.Template.Spec.Containers, container)
+		}
+		if isManagedUniversalContainer(c) {
+			managed = true
+			p.addManagedContainer(container.Name)
+		}
+	}
+	if managed {
+		p.Spec.Template.Spec.TerminationGracePeriodSeconds = profile.TerminationGracePeriodSeconds
+		if g, s := profile.TerminationGracePeriodSeconds, profile.Lifecycle.PreStop.Sleep; g != nil && *g <= int64(s) {
+			log.Printf("警告: terminationGracePeriodSeconds (%d) 不大于 lifecycle.preStop.sleep (%d)，容器可能在 preStop 完成前被强制终止", *g, s)
+		}
+		// 挂载 volumes 字段中的卷
+		if p.Spec.Template.Spec.Volumes, err = profile.Volumes.Generate(); err != nil {
+			return
+		}
+		// 挂载 config 字段生成的 ConfigMap
+		if attachments.ConfigMap != nil {
+			p.Spec.Template.Spec.Volumes = append(p.Spec.Template.Spec.Volumes, corev1.Volume{
+				Name: ConfigMapVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: attachments.ConfigMap.Name},
+					},
+				},
+			})
+		}
+		// 记录 deployer2 添加的卷，用于之后清理不再声明的卷
+		var names []string
+		for _, v := range p.Spec.Template.Spec.Volumes {
+			names = append(names, v.Name)
+		}
+		p.Spec.Template.Metadata.Annotations[AnnotationVolumes] = strings.Join(names, ",")
+	}
+	// 边车容器，按照容器名合并，重复部署时更新而不是重复添加
+	if len(profile.Sidecars) > 0 {
+		var sidecars []corev1.Container
+		var unlimited map[string][]corev1.ResourceName
+		if sidecars, unlimited, err = profile.Sidecars.Generate(preset, profile); err != nil {
+			return
+		}
+		for name, names := range unlimited {
+			p.addUnlimitedResources(name, names)
+		}
+		for _, sidecar := range sidecars {
+			for _, c := range workload.Containers() {
+				if sidecar.Name == c.Container {
+					err = errors.New("sidecars 中的容器名与目标容器重复: " + sidecar.Name)
+					return
+				}
+			}
+		}
+		for _, sidecar := range sidecars {
+			p.addManagedContainer(sidecar.Name)
+		}
+		p.Spec.Template.Spec.Containers = append(p.Spec.Template.Spec.Containers, sidecars...)
+		p.Spec.Template.Metadata.Annotations[AnnotationSidecars] = strings.Join(profile.Sidecars.Names(), ",")
+	}
+	return
+}
+
+// isManagedUniversalContainer 是否使用环境配置生成容器的完整配置，未指定角色的初始化容器只更新镜像
+func isManagedUniversalContainer(c UniversalWorkloadContainer) bool {
+	return !c.Labels.Init || c.Labels.Role != ""
+}
+
+// createUniversalContainer 使用环境配置生成单个容器，初始化容器不设置端口，生命周期和健康检查
+func createUniversalContainer(preset *Preset, profile *Profile, c UniversalWorkloadContainer, attachments *UniversalAttachments, imageName string) (container corev1.Container, unlimited []corev1.ResourceName, err error) {
+	container = corev1.Container{
+		Image:           imageName,
+		Name:            c.Container,
+		ImagePullPolicy: "Always",
+	}
+	if !isManagedUniversalContainer(c) {
+		return
+	}
+	// 资源配额，profile.resource 中的设置覆盖 preset 中的设置
+	resources := preset.Resource.Override(profile.Resource)
+	if container.Resources, unlimited, err = resources.Generate(preset.UnlimitedCap); err != nil {
+		return
+	}
+	// 集群资源策略
+	if container.Resources, unlimited, err = preset.ResourcePolicy.Enforce(container.Name, resources, container.Resources, unlimited); err != nil {
+		return
+	}
+	if container.Command, err = profile.RenderStrings(profile.Command); err != nil {
+		return
+	}
+	if container.Args, err = profile.RenderStrings(profile.Args); err != nil {
+		return
+	}
+	if profile.WorkingDir != "" {
+		var buf []byte
+		if buf, err = profile.Render(profile.WorkingDir); err != nil {
+			return
+		}
+		container.WorkingDir = string(buf)
+	}
+	if container.Env, err = profile.Env.Generate(profile.Render); err != nil {
+		return
+	}
+	// 使用 secrets 字段生成的 Secret 作为环境变量
+	if attachments.Secret != nil {
+		container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: attachments.Secret.Name},
+			},
+		})
+	}
+	// 挂载 volumes 字段中的卷
+	for _, m := range profile.VolumeMounts {
+		if profile.Volumes[m.Name] == nil {
+			err = errors.New("volumeMounts 引用了未在 volumes 中声明的卷: " + m.Name)
+			return
+		}
+		var vm corev1.VolumeMount
+		if vm, err = m.Generate(); err != nil {
+			return
+		}
+		container.VolumeMounts = append(container.VolumeMounts, vm)
+	}
+	// 挂载 config 字段生成的 ConfigMap
+	if attachments.ConfigMap != nil {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      ConfigMapVolumeName,
+			MountPath: profile.Config.MountPath,
+			ReadOnly:  true,
+		})
+	}
+	if c.Labels.Init {
+		return
+	}
+	if container.Ports, err = profile.Ports.Generate(); err != nil {
+		return
+	}
+	if container.Lifecycle, err = profile.Lifecycle.Generate(); err != nil {
+		return
+	}
+	if !c.Labels.NoCheck {
+		if err = profile.Check.Validate(); err != nil {
+			return
+		}
+		container.LivenessProbe = profile.Check.GenerateLivenessProbe()
+		container.ReadinessProbe = profile.Check.GenerateReadinessProbe()
+		container.StartupProbe = profile.Check.GenerateStartupProbe()
+	}
+	return
+}
+
+// PruneSidecars 对比上一次部署时 deployer2 添加的边车容器，删除本次不再声明的边车容器，不会删除其他方式添加的容器
+func (p *UniversalPatch) PruneSidecars(previous []string) {
+	current := map[string]bool{}
+	for _, c := range p.Spec.Template.Spec.Containers {
+		current[c.Name] = true
+	}
+	for _, c := range p.Spec.Template.Spec.InitContainers {
+		current[c.Name] = true
+	}
+	p.PrunedContainers = nil
+	for _, name := range previous {
+		if !current[name] {
+			p.PrunedContainers = append(p.PrunedContainers, name)
 		}
-		p.Spec.Template.Spec.InitContainers = append(p.Spec.Template.Spec.InitContainers, container)
-	} else {
-		container := corev1.Container{
-			Image:           imageName,
-			Name:            workload.Container,
-			ImagePullPolicy: "Always",
+	}
+	if len(p.PrunedContainers) > 0 && p.Spec.Template.Metadata.Annotations[AnnotationSidecars] == "" {
+		if p.Spec.Template.Metadata.Annotations == nil {
+			p.Spec.Template.Metadata.Annotations = map[string]string{}
 		}
-		if container.Resources.Requests == nil {
-			container.Resources.Requests = map[corev1.ResourceName]resource.Quantity{}
+		p.Spec.Template.Metadata.Annotations[AnnotationSidecars] = ""
+	}
+}
+
+// PruneVolumes 对比工作负载 live 中上一次部署时 deployer2 添加的卷，删除本次不再声明的卷，
+// 以及 deployer2 管理的容器中不再声明的挂载，仍然被其他容器挂载的卷不会被删除，需要在 PruneSidecars 之后调用
+func (p *UniversalPatch) PruneVolumes(live []byte) (err error) {
+	p.PrunedVolumes, p.PrunedVolumeMounts = nil, nil
+	// 没有 deployer2 管理的容器时，不会生成卷
+	if _, ok := p.Spec.Template.Metadata.Annotations[AnnotationVolumes]; !ok {
+		return
+	}
+	var obj struct {
+		Spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if err = json.Unmarshal(live, &obj); err != nil {
+		return
+	}
+	previous := splitUniversalNames(obj.Spec.Template.Annotations[AnnotationVolumes])
+
+	// deployer2 管理的卷，包括上一次部署和本次部署添加的卷
+	owned, pruned := map[string]bool{}, map[string]bool{}
+	for _, v := range p.Spec.Template.Spec.Volumes {
+		owned[v.Name] = true
+	}
+	for _, name := range previous {
+		if !owned[name] {
+			pruned[name] = true
 		}
-		if container.Resources.Limits == nil {
-			container.Resources.Limits = map[corev1.ResourceName]resource.Quantity{}
+		owned[name] = true
+	}
+
+	mounts := map[string][]corev1.VolumeMount{}
+	for _, c := range append(append([]corev1.Container{}, p.Spec.Template.Spec.InitContainers...), p.Spec.Template.Spec.Containers...) {
+		if p.managedContainers[c.Name] {
+			mounts[c.Name] = c.VolumeMounts
 		}
-		// 从 preset 取值
-		cpu, mem := preset.Resource.CPU, preset.Resource.MEM
+	}
+	removed := map[string]bool{}
+	for _, name := range p.PrunedContainers {
+		removed[name] = true
+	}
+	for _, c := range append(append([]corev1.Container{}, obj.Spec.Template.Spec.InitContainers...), obj.Spec.Template.Spec.Containers...) {
+		if removed[c.Name] {
+			continue
+		}
+		current, managed := mounts[c.Name]
+		for _, m := range c.VolumeMounts {
+			if !owned[m.Name] {
+				continue
+			}
+			if !managed {
+				if pruned[m.Name] {
+					log.Printf("警告: 卷 %s 仍然被容器 %s 挂载，不会被移除", m.Name, c.Name)
+					delete(pruned, m.Name)
+				}
+				continue
+			}
+			if !hasVolumeMount(current, m.MountPath) {
+				if p.PrunedVolumeMounts == nil {
+					p.PrunedVolumeMounts = map[string][]string{}
+				}
+				p.PrunedVolumeMounts[c.Name] = append(p.PrunedVolumeMounts[c.Name], m.MountPath)
+			}
+		}
+	}
+	for _, name := range previous {
+		if pruned[name] {
+			p.PrunedVolumes = append(p.PrunedVolumes, name)
+		}
+	}
+	return
+}
 
-		// 从 profile.resource 字段取值
-		if profile.Resource.CPU != nil {
-			cpu = profile.Resource.CPU
+// CheckSelector 校验 podLabels 没有修改工作负载选择器 selector 使用的标签，否则新的 Pod 不再被工作负载选中，
+// 与选择器中 matchLabels 取值相同的标签和 deployer2 内部使用的标签除外
+func (p *UniversalPatch) CheckSelector(selector *metav1.LabelSelector) (err error) {
+	if selector == nil {
+		return
+	}
+	keys := map[string]bool{}
+	for _, e := range selector.MatchExpressions {
+		keys[e.Key] = true
+	}
+	var names []string
+	for k, v := range p.Spec.Template.Metadata.Labels {
+		if k == LabelWorkload {
+			continue
 		}
-		if profile.Resource.MEM != nil {
-			mem = profile.Resource.MEM
+		if sv, ok := selector.MatchLabels[k]; (ok && sv != v) || keys[k] {
+			names = append(names, k)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		err = errors.New("podLabels 不允许修改工作负载选择器使用的标签: " + strings.Join(names, ", "))
+		return
+	}
+	return
+}
+
+func hasVolumeMount(mounts []corev1.VolumeMount, mountPath string) bool {
+	for _, m := range mounts {
+		if m.MountPath == mountPath {
+			return true
 		}
+	}
+	return false
+}
+
+func (p *UniversalPatch) addManagedContainer(name string) {
+	if p.managedContainers == nil {
+		p.managedContainers = map[string]bool{}
+	}
+	p.managedContainers[name] = true
+}
 
-		// 赋值
-		if cpu != nil {
-			container.Resources.Requests[corev1.ResourceCPU],
-				container.Resources.Limits[corev1.ResourceCPU] = cpu.AsCPU()
+func (p *UniversalPatch) addUnlimitedResources(container string, names []corev1.ResourceName) {
+	if len(names) == 0 {
+		return
+	}
+	if p.UnlimitedResources == nil {
+		p.UnlimitedResources = map[string][]corev1.ResourceName{}
+	}
+	p.UnlimitedResources[container] = append(p.UnlimitedResources[container], names...)
+}
+
+func (p UniversalPatch) MarshalJSON() (buf []byte, err error) {
+	type alias UniversalPatch
+	if buf, err = json.Marshal(alias(p)); err != nil {
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(buf, &m); err != nil {
+		return
+	}
+	spec := jsonObject(jsonObject(jsonObject(m, "spec"), "template"), "spec")
+	// 将无限制资源的限制值设置为 null，删除工作负载中已有的限制值
+	for _, key := range []string{"initContainers", "containers"} {
+		containers, _ := spec[key].([]interface{})
+		for _, item := range containers {
+			c, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := c["name"].(string)
+			if len(p.UnlimitedResources[name]) > 0 {
+				limits := jsonObject(jsonObject(c, "resources"), "limits")
+				for _, n := range p.UnlimitedResources[name] {
+					limits[string(n)] = nil
+				}
+			}
+			// 探针和生命周期只能设置一种处理方式，将未使用的处理方式设置为 null，删除工作负载中已有的其他处理方式
+			for _, key := range []string{"livenessProbe", "readinessProbe", "startupProbe"} {
+				if probe, ok := c[key].(map[string]interface{}); ok {
+					nullUniversalHandlers(probe)
+				}
+			}
+			if lifecycle, ok := c["lifecycle"].(map[string]interface{}); ok {
+				for _, key := range []string{"postStart", "preStop"} {
+					if h, ok := lifecycle[key].(map[string]interface{}); ok {
+						nullUniversalHandlers(h)
+					}
+				}
+			}
+			// deployer2 管理的容器，将不再声明的字段设置为 null，env 使用 $patch: replace 指令整体替换，删除工作负载中已有的值
+			if p.managedContainers[name] {
+				for _, key := range universalContainerKeys {
+					if _, ok := c[key]; !ok {
+						c[key] = nil
+					}
+				}
+				env, _ := c["env"].([]interface{})
+				c["env"] = append(env, map[string]interface{}{"$patch": "replace"})
+			}
+			// 删除不再声明的挂载
+			if len(p.PrunedVolumeMounts[name]) > 0 {
+				mounts, _ := c["volumeMounts"].([]interface{})
+				for _, mountPath := range p.PrunedVolumeMounts[name] {
+					mounts = append(mounts, map[string]interface{}{"mountPath": mountPath, "$patch": "delete"})
+				}
+				c["volumeMounts"] = mounts
+			}
 		}
-		if mem != nil {
-			container.Resources.Requests[corev1.ResourceMemory],
-				container.Resources.Limits[corev1.ResourceMemory] = mem.AsMEM()
+	}
+	// 卷只能设置一种来源，使用 $retainKeys 指令删除工作负载中已有卷的其他来源
+	volumes, _ := spec["volumes"].([]interface{})
+	for _, item := range volumes {
+		v, ok := item.(map[string]interface{})
+		if !ok {
+			continue
 		}
-		if !workload.Labels.NoCheck {
-			container.LivenessProbe = profile.Check.GenerateLivenessProbe()
-			container.ReadinessProbe = profile.Check.GenerateReadinessProbe()
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
 		}
-		p.Spec.Template.Spec.Containers = append(p.Spec.Template.Spec.Containers, container)
+		sort.Strings(keys)
+		v["$retainKeys"] = keys
+	}
+	for _, name := range p.PrunedVolumes {
+		volumes = append(volumes, map[string]interface{}{"name": name, "$patch": "delete"})
+	}
+	if len(volumes) > 0 {
+		spec["volumes"] = volumes
+	}
+	// 使用 strategic merge patch 的 $patch: delete 指令删除容器
+	if len(p.PrunedContainers) > 0 {
+		containers, _ := spec["containers"].([]interface{})
+		for _, name := range p.PrunedContainers {
+			containers = append(containers, map[string]interface{}{"name": name, "$patch": "delete"})
+		}
+		spec["containers"] = containers
+	}
+	buf, err = json.Marshal(m)
+	return
+}
+
+// universalContainerKeys deployer2 管理的容器中，不再声明时需要删除的字段名
+var universalContainerKeys = []string{"command", "args", "workingDir", "envFrom"}
+
+// universalHandlerKeys 探针和生命周期处理方式的字段名
+var universalHandlerKeys = []string{"exec", "httpGet", "tcpSocket"}
+
+// nullUniversalHandlers 将 h 中未使用的处理方式设置为 null
+func nullUniversalHandlers(h map[string]interface{}) {
+	for _, key := range universalHandlerKeys {
+		if _, ok := h[key]; !ok {
+			h[key] = nil
+		}
+	}
+}
+
+// jsonObject 返回 m 中 key 对应的对象，不存在时创建
+func jsonObject(m map[string]interface{}, key string) map[string]interface{} {
+	if o, ok := m[key].(map[string]interface{}); ok {
+		return o
 	}
-	return p
+	o := map[string]interface{}{}
+	m[key] = o
+	return o
 }
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testManifestVolumes = `
+version: 2
+default:
+  volumes:
+    cache:
+      emptyDir:
+        sizeLimit: 1Gi
+    certs:
+      secret:
+        name: tls-certs
+    logs:
+      hostPath:
+        path: /var/log
+  volumeMounts:
+    - name: cache
+      mountPath: /cache
+dev:
+  volumes:
+    logs: ~
+    cache:
+      persistentVolumeClaim:
+        claimName: cache
+  volumeMounts:
+    - name: cache
+      mountPath: /cache
+    - name: certs
+      mountPath: /etc/certs
+      readOnly: true
+`
+)
+
+func TestCreateUniversalPatch_Volumes(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestVolumes), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	volumes := p.Spec.Template.Spec.Volumes
+	require.Len(t, volumes, 2)
+	assert.Equal(t, "cache", volumes[0].Name)
+	assert.Nil(t, volumes[0].EmptyDir)
+	assert.Equal(t, "cache", volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "certs", volumes[1].Name)
+	assert.Equal(t, "tls-certs", volumes[1].Secret.SecretName)
+	mounts := p.Spec.Template.Spec.Containers[0].VolumeMounts
+	require.Len(t, mounts, 2)
+	assert.Equal(t, "/etc/certs", mounts[1].MountPath)
+	assert.True(t, mounts[1].ReadOnly)
+
+	assert.Equal(t, "cache,certs", p.Spec.Template.Metadata.Annotations[AnnotationVolumes])
+
+	profile.VolumeMounts = append(profile.VolumeMounts, ProfileVolumeMount{Name: "logs", MountPath: "/logs"})
+	_, err = CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+
+	profile.Volumes["broken"] = &ProfileVolume{}
+	_, err = CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+}
+
+func TestCreateUniversalPatch_Command(t *testing.T) {
+	profile := &Profile{
+		Profile:    "dev",
+		Vars:       map[string]interface{}{"queue": "jobs"},
+		Command:    []string{"/app/bin/worker"},
+		Args:       []string{"--queue", "{{.Vars.queue}}-{{.Profile}}"},
+		WorkingDir: "/app/{{.Profile}}",
+		Ports: ProfilePorts{
+			{Name: "http", Port: 8080},
+			{Name: "metrics", Port: 9090, Protocol: "udp"},
+		},
+	}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	container := p.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{"/app/bin/worker"}, container.Command)
+	assert.Equal(t, []string{"--queue", "jobs-dev"}, container.Args)
+	assert.Equal(t, "/app/dev", container.WorkingDir)
+	require.Len(t, container.Ports, 2)
+	assert.Equal(t, "http", container.Ports[0].Name)
+	assert.Equal(t, int32(8080), container.Ports[0].ContainerPort)
+	assert.Equal(t, "TCP", string(container.Ports[0].Protocol))
+	assert.Equal(t, "UDP", string(container.Ports[1].Protocol))
+
+	profile.Ports = append(profile.Ports, ProfilePort{Port: 8081})
+	_, err = CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+}
+
+func TestCreateUniversalPatch_Lifecycle(t *testing.T) {
+	grace := int64(60)
+	profile := &Profile{
+		Lifecycle: ProfileLifecycle{
+			PreStop: ProfileLifecycleHandler{Sleep: 15},
+		},
+		TerminationGracePeriodSeconds: &grace,
+	}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), *p.Spec.Template.Spec.TerminationGracePeriodSeconds)
+	container := p.Spec.Template.Spec.Containers[0]
+	require.NotNil(t, container.Lifecycle)
+	assert.Equal(t, []string{"sleep", "15"}, container.Lifecycle.PreStop.Exec.Command)
+
+	profile.Lifecycle.PreStop.Exec = []string{"/app/drain"}
+	_, err = CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+
+	profile.Lifecycle.PreStop.Sleep = 0
+	p, err = CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/app/drain"}, p.Spec.Template.Spec.Containers[0].Lifecycle.PreStop.Exec.Command)
+}
+
+func TestUniversalPatch_MarshalJSON_Handlers(t *testing.T) {
+	profile := &Profile{
+		Check: UniversalCheck{Type: CheckTypeTCP, Port: 8080},
+	}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	buf, err := json.Marshal(p)
+	require.NoError(t, err)
+	var out struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						ReadinessProbe map[string]interface{} `json:"readinessProbe"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &out))
+	probe := out.Spec.Template.Spec.Containers[0].ReadinessProbe
+	require.NotNil(t, probe)
+	// 切换为 tcp 时删除工作负载中已有的 httpGet
+	v, ok := probe["httpGet"]
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	v, ok = probe["exec"]
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	assert.NotNil(t, probe["tcpSocket"])
+}
+
+func TestUniversalPatch_MarshalJSON_RemovedFields(t *testing.T) {
+	profile := &Profile{
+		Command: []string{"/app/bin/web"},
+		Env:     ProfileEnvs{"MODE": {Value: "web"}},
+	}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa/migrate?init+whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	buf, err := json.Marshal(p)
+	require.NoError(t, err)
+	var out struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					InitContainers []map[string]interface{} `json:"initContainers"`
+					Containers     []map[string]interface{} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &out))
+
+	c := out.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []interface{}{"/app/bin/web"}, c["command"])
+	// 不再声明的字段设置为 null
+	for _, key := range []string{"args", "workingDir", "envFrom"} {
+		v, ok := c[key]
+		assert.True(t, ok, key)
+		assert.Nil(t, v, key)
+	}
+	// env 整体替换
+	env := c["env"].([]interface{})
+	require.Len(t, env, 2)
+	assert.Equal(t, "MODE", env[0].(map[string]interface{})["name"])
+	assert.Equal(t, map[string]interface{}{"$patch": "replace"}, env[1])
+
+	// 只更新镜像的初始化容器不受影响
+	init := out.Spec.Template.Spec.InitContainers[0]
+	_, ok := init["command"]
+	assert.False(t, ok)
+	_, ok = init["env"]
+	assert.False(t, ok)
+}
+
+const (
+	testPresetScheduling = `
+nodeSelector:
+  pool: apps
+  disk: ssd
+tolerations:
+  - key: dedicated
+    operator: Equal
+    value: apps
+    effect: NoSchedule
+`
+	testManifestScheduling = `
+version: 2
+default:
+  nodeSelector:
+    disk: hdd
+  spread: hostname
+dev:
+  tolerations:
+    - key: gpu
+      operator: Exists
+  topologySpreadConstraints:
+    - topologyKey: zone
+      maxSkew: 2
+`
+)
+
+func TestCreateUniversalPatch_Scheduling(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetScheduling), &preset))
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestScheduling), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&preset, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	spec := p.Spec.Template.Spec
+	assert.Equal(t, "whoa", p.Spec.Template.Metadata.Labels[LabelWorkload])
+	// 集群预置文件中的 nodeSelector 优先，环境配置不能修改
+	assert.Equal(t, map[string]string{"pool": "apps", "disk": "ssd"}, spec.NodeSelector)
+	require.Len(t, spec.Tolerations, 2)
+	assert.Equal(t, "dedicated", spec.Tolerations[0].Key)
+	assert.Equal(t, "gpu", spec.Tolerations[1].Key)
+	terms := spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	require.Len(t, terms, 1)
+	assert.Equal(t, "kubernetes.io/hostname", terms[0].PodAffinityTerm.TopologyKey)
+	assert.Equal(t, "whoa", terms[0].PodAffinityTerm.LabelSelector.MatchLabels[LabelWorkload])
+	require.Len(t, spec.TopologySpreadConstraints, 1)
+	assert.Equal(t, "topology.kubernetes.io/zone", spec.TopologySpreadConstraints[0].TopologyKey)
+	assert.Equal(t, int32(2), spec.TopologySpreadConstraints[0].MaxSkew)
+	assert.Equal(t, "ScheduleAnyway", string(spec.TopologySpreadConstraints[0].WhenUnsatisfiable))
+
+	profile.Spread = "rack"
+	_, err = CreateUniversalPatch(&preset, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	assert.Error(t, err)
+}
+
+const (
+	testManifestSiblings = `
+version: 2
+default:
+  command: ["/app/server"]
+  check:
+    path: /healthz
+  env:
+    DB: mysql://db
+  roles:
+    migrate:
+      command: ["/app/migrate"]
+`
+)
+
+func TestCreateUniversalPatch_Siblings(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestSiblings), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa/migrate?init,role=migrate+whoa+legacy?init"))
+
+	p, err := CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	inits := p.Spec.Template.Spec.InitContainers
+	require.Len(t, inits, 2)
+	assert.Equal(t, "migrate", inits[0].Name)
+	assert.Equal(t, "whoa:dev", inits[0].Image)
+	assert.Equal(t, []string{"/app/migrate"}, inits[0].Command)
+	assert.Equal(t, "mysql://db", inits[0].Env[0].Value)
+	assert.Nil(t, inits[0].LivenessProbe)
+	assert.Equal(t, "legacy", inits[1].Name)
+	assert.Nil(t, inits[1].Command)
+	assert.Nil(t, inits[1].Env)
+	containers := p.Spec.Template.Spec.Containers
+	require.Len(t, containers, 1)
+	assert.Equal(t, "whoa", containers[0].Name)
+	assert.Equal(t, []string{"/app/server"}, containers[0].Command)
+	assert.NotNil(t, containers[0].LivenessProbe)
+}
+
+func TestUniversalPatch_PruneVolumes(t *testing.T) {
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestVolumes), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+
+	// 上一次部署时 logs 卷挂载在 whoa 容器中，old 卷同时被其他容器挂载
+	live := []byte(`{"spec":{"template":{
+		"metadata":{"annotations":{"net.guoyk.deployer/volumes":"cache,logs,old"}},
+		"spec":{"containers":[
+			{"name":"whoa","volumeMounts":[{"name":"cache","mountPath":"/cache"},{"name":"logs","mountPath":"/logs"},{"name":"manual","mountPath":"/manual"}]},
+			{"name":"other","volumeMounts":[{"name":"old","mountPath":"/old"}]}
+		]}
+	}}}`)
+	require.NoError(t, p.PruneVolumes(live))
+	assert.Equal(t, []string{"logs"}, p.PrunedVolumes)
+	assert.Equal(t, map[string][]string{"whoa": {"/logs"}}, p.PrunedVolumeMounts)
+
+	buf, err := json.Marshal(p)
+	require.NoError(t, err)
+	var out struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Volumes    []map[string]interface{} `json:"volumes"`
+					Containers []struct {
+						VolumeMounts []map[string]interface{} `json:"volumeMounts"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &out))
+	volumes := out.Spec.Template.Spec.Volumes
+	require.Len(t, volumes, 3)
+	// 卷的来源变化时，删除工作负载中已有的其他来源
+	assert.Equal(t, []interface{}{"name", "persistentVolumeClaim"}, volumes[0]["$retainKeys"])
+	assert.Equal(t, "logs", volumes[2]["name"])
+	assert.Equal(t, "delete", volumes[2]["$patch"])
+	mounts := out.Spec.Template.Spec.Containers[0].VolumeMounts
+	require.Len(t, mounts, 3)
+	assert.Equal(t, "/logs", mounts[2]["mountPath"])
+	assert.Equal(t, "delete", mounts[2]["$patch"])
+}
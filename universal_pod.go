@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"log"
+	"sort"
+)
+
+// UniversalPodSecurityContext Pod 级别的安全上下文
+type UniversalPodSecurityContext struct {
+	RunAsUser          *int64  `yaml:"runAsUser"`
+	RunAsGroup         *int64  `yaml:"runAsGroup"`
+	RunAsNonRoot       *bool   `yaml:"runAsNonRoot"`
+	FSGroup            *int64  `yaml:"fsGroup"`
+	SupplementalGroups []int64 `yaml:"supplementalGroups"`
+}
+
+// UniversalContainerSecurityContext 容器级别的安全上下文
+type UniversalContainerSecurityContext struct {
+	RunAsUser                *int64 `yaml:"runAsUser"`
+	RunAsGroup               *int64 `yaml:"runAsGroup"`
+	RunAsNonRoot             *bool  `yaml:"runAsNonRoot"`
+	Privileged               *bool  `yaml:"privileged"`
+	ReadOnlyRootFilesystem   *bool  `yaml:"readOnlyRootFilesystem"`
+	AllowPrivilegeEscalation *bool  `yaml:"allowPrivilegeEscalation"`
+	Capabilities             struct {
+		Add  []string `yaml:"add"`
+		Drop []string `yaml:"drop"`
+	} `yaml:"capabilities"`
+}
+
+// UniversalPod Pod 级别的配置，集群预置文件和环境配置中均可设置，预置文件中的值为强制默认值，环境配置无法覆盖
+type UniversalPod struct {
+	PodLabels                map[string]string                  `yaml:"podLabels"`
+	PodAnnotations           map[string]string                  `yaml:"podAnnotations"`
+	ServiceAccountName       string                             `yaml:"serviceAccountName"`
+	SecurityContext          *UniversalPodSecurityContext       `yaml:"securityContext"`
+	ContainerSecurityContext *UniversalContainerSecurityContext `yaml:"containerSecurityContext"`
+}
+
+func enforceString(field string, enforced, value string) string {
+	if enforced == "" {
+		return value
+	}
+	if value != "" && value != enforced {
+		log.Printf("警告: 集群预置文件强制设置了 %s 为 %s，忽略环境配置中的 %s", field, enforced, value)
+	}
+	return enforced
+}
+
+func enforceInt64(field string, enforced, value *int64) *int64 {
+	if enforced == nil {
+		return value
+	}
+	if value != nil && *value != *enforced {
+		log.Printf("警告: 集群预置文件强制设置了 %s 为 %d，忽略环境配置中的 %d", field, *enforced, *value)
+	}
+	return enforced
+}
+
+func enforceBool(field string, enforced, value *bool) *bool {
+	if enforced == nil {
+		return value
+	}
+	if value != nil && *value != *enforced {
+		log.Printf("警告: 集群预置文件强制设置了 %s 为 %t，忽略环境配置中的 %t", field, *enforced, *value)
+	}
+	return enforced
+}
+
+func enforceStrings(field string, enforced, value map[string]string) (out map[string]string) {
+	if enforced == nil && value == nil {
+		return
+	}
+	out = map[string]string{}
+	for k, v := range value {
+		out[k] = v
+	}
+	var keys []string
+	for k := range enforced {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := out[k]; ok && v != enforced[k] {
+			log.Printf("警告: 集群预置文件强制设置了 %s.%s 为 %s，忽略环境配置中的 %s", field, k, enforced[k], v)
+		}
+		out[k] = enforced[k]
+	}
+	return
+}
+
+// Enforce 以 o 为基础合并集群预置文件中的配置 s，s 中设置的字段优先，o 只能补充 s 中未设置的字段
+func (s UniversalPod) Enforce(o UniversalPod) (out UniversalPod) {
+	out.PodLabels = enforceStrings("podLabels", s.PodLabels, o.PodLabels)
+	out.PodAnnotations = enforceStrings("podAnnotations", s.PodAnnotations, o.PodAnnotations)
+	out.ServiceAccountName = enforceString("serviceAccountName", s.ServiceAccountName, o.ServiceAccountName)
+	if s.SecurityContext != nil || o.SecurityContext != nil {
+		var sp, so UniversalPodSecurityContext
+		if s.SecurityContext != nil {
+			sp = *s.SecurityContext
+		}
+		if o.SecurityContext != nil {
+			so = *o.SecurityContext
+		}
+		out.SecurityContext = &UniversalPodSecurityContext{
+			RunAsUser:          enforceInt64("securityContext.runAsUser", sp.RunAsUser, so.RunAsUser),
+			RunAsGroup:         enforceInt64("securityContext.runAsGroup", sp.RunAsGroup, so.RunAsGroup),
+			RunAsNonRoot:       enforceBool("securityContext.runAsNonRoot", sp.RunAsNonRoot, so.RunAsNonRoot),
+			FSGroup:            enforceInt64("securityContext.fsGroup", sp.FSGroup, so.FSGroup),
+			SupplementalGroups: append(append([]int64{}, sp.SupplementalGroups...), so.SupplementalGroups...),
+		}
+	}
+	if s.ContainerSecurityContext != nil || o.ContainerSecurityContext != nil {
+		var sp, so UniversalContainerSecurityContext
+		if s.ContainerSecurityContext != nil {
+			sp = *s.ContainerSecurityContext
+		}
+		if o.ContainerSecurityContext != nil {
+			so = *o.ContainerSecurityContext
+		}
+		c := &UniversalContainerSecurityContext{
+			RunAsUser:                enforceInt64("containerSecurityContext.runAsUser", sp.RunAsUser, so.RunAsUser),
+			RunAsGroup:               enforceInt64("containerSecurityContext.runAsGroup", sp.RunAsGroup, so.RunAsGroup),
+			RunAsNonRoot:             enforceBool("containerSecurityContext.runAsNonRoot", sp.RunAsNonRoot, so.RunAsNonRoot),
+			Privileged:               enforceBool("containerSecurityContext.privileged", sp.Privileged, so.Privileged),
+			ReadOnlyRootFilesystem:   enforceBool("containerSecurityContext.readOnlyRootFilesystem", sp.ReadOnlyRootFilesystem, so.ReadOnlyRootFilesystem),
+			AllowPrivilegeEscalation: enforceBool("containerSecurityContext.allowPrivilegeEscalation", sp.AllowPrivilegeEscalation, so.AllowPrivilegeEscalation),
+		}
+		// 预置文件中 drop 的能力不允许在环境配置中 add
+		for _, name := range so.Capabilities.Add {
+			var dropped bool
+			for _, d := range sp.Capabilities.Drop {
+				if d == name || d == "ALL" {
+					dropped = true
+				}
+			}
+			if dropped {
+				log.Printf("警告: 集群预置文件强制移除了能力 %s，忽略环境配置中的 containerSecurityContext.capabilities.add", name)
+				continue
+			}
+			c.Capabilities.Add = append(c.Capabilities.Add, name)
+		}
+		c.Capabilities.Add = append(c.Capabilities.Add, sp.Capabilities.Add...)
+		c.Capabilities.Drop = append(append(c.Capabilities.Drop, sp.Capabilities.Drop...), so.Capabilities.Drop...)
+		out.ContainerSecurityContext = c
+	}
+	return
+}
+
+// GenerateLabels 渲染 Pod 标签，标签的值需要符合 Kubernetes 规范，因此不允许覆盖 deployer2 内部使用的标签
+func (s UniversalPod) GenerateLabels(render func(string) ([]byte, error)) (out map[string]string, err error) {
+	out = map[string]string{}
+	for k, v := range s.PodLabels {
+		if k == LabelWorkload {
+			err = errors.New("podLabels 不允许设置 deployer2 内部使用的标签: " + k)
+			return
+		}
+		var buf []byte
+		if buf, err = render(v); err != nil {
+			return
+		}
+		out[k] = string(buf)
+	}
+	return
+}
+
+// GenerateAnnotations 渲染 Pod 注解，比如使用 {{.Check.Port}} 生成 Prometheus 抓取配置
+func (s UniversalPod) GenerateAnnotations(render func(string) ([]byte, error)) (out map[string]string, err error) {
+	out = map[string]string{}
+	for k, v := range s.PodAnnotations {
+		if k == AnnotationTimestamp {
+			err = errors.New("podAnnotations 不允许设置 deployer2 内部使用的注解: " + k)
+			return
+		}
+		var buf []byte
+		if buf, err = render(v); err != nil {
+			return
+		}
+		out[k] = string(buf)
+	}
+	return
+}
+
+func (s UniversalPod) GenerateSecurityContext() (out *corev1.PodSecurityContext) {
+	if s.SecurityContext == nil {
+		return
+	}
+	out = &corev1.PodSecurityContext{
+		RunAsUser:          s.SecurityContext.RunAsUser,
+		RunAsGroup:         s.SecurityContext.RunAsGroup,
+		RunAsNonRoot:       s.SecurityContext.RunAsNonRoot,
+		FSGroup:            s.SecurityContext.FSGroup,
+		SupplementalGroups: s.SecurityContext.SupplementalGroups,
+	}
+	return
+}
+
+func (s UniversalPod) GenerateContainerSecurityContext() (out *corev1.SecurityContext, err error) {
+	c := s.ContainerSecurityContext
+	if c == nil {
+		return
+	}
+	if c.Privileged != nil && *c.Privileged && c.AllowPrivilegeEscalation != nil && !*c.AllowPrivilegeEscalation {
+		err = errors.New("containerSecurityContext 不能同时设置 privileged: true 和 allowPrivilegeEscalation: false")
+		return
+	}
+	out = &corev1.SecurityContext{
+		RunAsUser:                c.RunAsUser,
+		RunAsGroup:               c.RunAsGroup,
+		RunAsNonRoot:             c.RunAsNonRoot,
+		Privileged:               c.Privileged,
+		ReadOnlyRootFilesystem:   c.ReadOnlyRootFilesystem,
+		AllowPrivilegeEscalation: c.AllowPrivilegeEscalation,
+	}
+	if len(c.Capabilities.Add) > 0 || len(c.Capabilities.Drop) > 0 {
+		out.Capabilities = &corev1.Capabilities{}
+		for _, name := range c.Capabilities.Add {
+			out.Capabilities.Add = append(out.Capabilities.Add, corev1.Capability(name))
+		}
+		for _, name := range c.Capabilities.Drop {
+			out.Capabilities.Drop = append(out.Capabilities.Drop, corev1.Capability(name))
+		}
+	}
+	return
+}
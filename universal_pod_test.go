@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testPresetPod = `
+podLabels:
+  team: infra
+serviceAccountName: restricted
+securityContext:
+  runAsNonRoot: true
+containerSecurityContext:
+  allowPrivilegeEscalation: false
+  capabilities:
+    drop: ["ALL"]
+`
+	testManifestPod = `
+version: 2
+default:
+  check:
+    port: 9090
+  podLabels:
+    team: web
+    app: whoa
+  podAnnotations:
+    prometheus.io/scrape: "true"
+    prometheus.io/port: "{{.Check.Port}}"
+dev:
+  serviceAccountName: whoa
+  securityContext:
+    runAsNonRoot: false
+    fsGroup: 1000
+  containerSecurityContext:
+    readOnlyRootFilesystem: true
+    capabilities:
+      add: ["NET_ADMIN"]
+`
+)
+
+func TestCreateUniversalPatch_Pod(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetPod), &preset))
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestPod), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	p, err := CreateUniversalPatch(&preset, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	labels := p.Spec.Template.Metadata.Labels
+	assert.Equal(t, "infra", labels["team"])
+	assert.Equal(t, "whoa", labels["app"])
+	assert.Equal(t, "whoa", labels[LabelWorkload])
+	annotations := p.Spec.Template.Metadata.Annotations
+	assert.Equal(t, "true", annotations["prometheus.io/scrape"])
+	assert.Equal(t, "9090", annotations["prometheus.io/port"])
+	assert.NotEmpty(t, annotations[AnnotationTimestamp])
+
+	spec := p.Spec.Template.Spec
+	assert.Equal(t, "restricted", spec.ServiceAccountName)
+	require.NotNil(t, spec.SecurityContext)
+	assert.True(t, *spec.SecurityContext.RunAsNonRoot)
+	assert.Equal(t, int64(1000), *spec.SecurityContext.FSGroup)
+
+	sc := spec.Containers[0].SecurityContext
+	require.NotNil(t, sc)
+	assert.False(t, *sc.AllowPrivilegeEscalation)
+	assert.True(t, *sc.ReadOnlyRootFilesystem)
+	require.NotNil(t, sc.Capabilities)
+	assert.Empty(t, sc.Capabilities.Add)
+	assert.Equal(t, "ALL", string(sc.Capabilities.Drop[0]))
+
+	// 只更新镜像的初始化容器不设置安全上下文
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa/migrate?init+whoa"))
+	p, err = CreateUniversalPatch(&preset, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	assert.Nil(t, p.Spec.Template.Spec.InitContainers[0].SecurityContext)
+	assert.NotNil(t, p.Spec.Template.Spec.Containers[0].SecurityContext)
+}
+
+func TestUniversalPod_GenerateLabels(t *testing.T) {
+	pod := UniversalPod{PodLabels: map[string]string{LabelWorkload: "other"}}
+	_, err := pod.GenerateLabels((&Profile{}).Render)
+	assert.Error(t, err)
+}
+
+func TestUniversalPatch_CheckSelector(t *testing.T) {
+	var p UniversalPatch
+	p.Spec.Template.Metadata.Labels = map[string]string{"app": "whoa", "team": "web", LabelWorkload: "whoa"}
+	assert.NoError(t, p.CheckSelector(nil))
+
+	selector, err := ParseUniversalSelector([]byte(`{"spec":{"selector":{"matchLabels":{"app":"whoa","net.guoyk.deployer/workload":"whoa"}}}}`))
+	require.NoError(t, err)
+	assert.NoError(t, p.CheckSelector(selector))
+
+	// 修改选择器中的标签
+	p.Spec.Template.Metadata.Labels["app"] = "other"
+	err = p.CheckSelector(selector)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "app")
+
+	selector, err = ParseUniversalSelector([]byte(`{"spec":{"selector":{"matchExpressions":[{"key":"team","operator":"Exists"}]}}}`))
+	require.NoError(t, err)
+	err = p.CheckSelector(selector)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "team")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"path"
+	"strings"
+)
+
+const (
+	PolicyTypeRequireProbes      = "requireProbes"
+	PolicyTypeImageRegistry      = "imageRegistry"
+	PolicyTypeNoHostPath         = "noHostPath"
+	PolicyTypeNamespaceAllowlist = "namespaceAllowlist"
+)
+
+// PresetPolicy 集群策略规则，在执行 kubectl patch 之前针对最终生成的补丁和工作负载进行校验
+// namespaces 为规则生效的命名空间，支持通配符，为空则对所有命名空间生效
+type PresetPolicy struct {
+	ID         string   `yaml:"id"`
+	Type       string   `yaml:"type"`
+	Namespaces []string `yaml:"namespaces"`
+
+	// Registries imageRegistry 规则允许的镜像仓库
+	Registries []string `yaml:"registries"`
+	// Allowed namespaceAllowlist 规则允许的命名空间，支持通配符
+	Allowed []string `yaml:"allowed"`
+}
+
+// PolicyResult 单条策略规则的校验结果
+type PolicyResult struct {
+	ID       string
+	Skipped  bool
+	Violated bool
+	Message  string
+}
+
+func (r PolicyResult) String() string {
+	switch {
+	case r.Skipped:
+		return "[" + r.ID + "] 跳过: " + r.Message
+	case r.Violated:
+		return "[" + r.ID + "] 违反: " + r.Message
+	default:
+		return "[" + r.ID + "] 通过"
+	}
+}
+
+// matchPatterns 判断 s 是否匹配任意一个通配符
+func matchPatterns(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (pp PresetPolicy) evaluate(workload *UniversalWorkload, patch *UniversalPatch) (violations []string, err error) {
+	spec := patch.Spec.Template.Spec
+	switch pp.Type {
+	case PolicyTypeRequireProbes:
+		// 边车容器不支持设置探针，不参与校验
+		sidecars := map[string]bool{}
+		for _, name := range splitUniversalNames(patch.Spec.Template.Metadata.Annotations[AnnotationSidecars]) {
+			sidecars[name] = true
+		}
+		for _, c := range spec.Containers {
+			if sidecars[c.Name] {
+				continue
+			}
+			if c.LivenessProbe == nil || c.ReadinessProbe == nil {
+				violations = append(violations, "容器 "+c.Name+" 缺少存活探针或者就绪探针")
+			}
+		}
+	case PolicyTypeImageRegistry:
+		for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+			var allowed bool
+			for _, r := range pp.Registries {
+				if strings.HasPrefix(c.Image, strings.TrimSuffix(r, "/")+"/") {
+					allowed = true
+				}
+			}
+			if !allowed {
+				violations = append(violations, "容器 "+c.Name+" 的镜像 "+c.Image+" 不在允许的镜像仓库中")
+			}
+		}
+	case PolicyTypeNoHostPath:
+		for _, v := range spec.Volumes {
+			if v.HostPath != nil {
+				violations = append(violations, "卷 "+v.Name+" 使用了 hostPath")
+			}
+		}
+	case PolicyTypeNamespaceAllowlist:
+		if !matchPatterns(pp.Allowed, workload.Namespace) {
+			violations = append(violations, "命名空间 "+workload.Namespace+" 不在允许的列表中")
+		}
+	default:
+		err = errors.New("策略 " + pp.ID + " 的类型 " + pp.Type + " 未知")
+	}
+	return
+}
+
+// PresetPolicies 集群策略规则列表
+type PresetPolicies []PresetPolicy
+
+// Validate 校验策略规则的 id，类型和必需字段，在加载集群预置文件时调用
+func (ps PresetPolicies) Validate() (err error) {
+	ids := map[string]bool{}
+	for _, pp := range ps {
+		if pp.ID == "" {
+			err = errors.New("集群策略规则缺少 id")
+			return
+		}
+		if ids[pp.ID] {
+			err = errors.New("集群策略规则 id 重复: " + pp.ID)
+			return
+		}
+		ids[pp.ID] = true
+		switch pp.Type {
+		case PolicyTypeRequireProbes, PolicyTypeNoHostPath:
+		case PolicyTypeImageRegistry:
+			if len(pp.Registries) == 0 {
+				err = errors.New("策略 " + pp.ID + " 缺少 registries 字段")
+				return
+			}
+		case PolicyTypeNamespaceAllowlist:
+			if len(pp.Allowed) == 0 {
+				err = errors.New("策略 " + pp.ID + " 缺少 allowed 字段")
+				return
+			}
+		default:
+			err = errors.New("策略 " + pp.ID + " 的类型 " + pp.Type + " 未知")
+			return
+		}
+	}
+	return
+}
+
+// Evaluate 依次校验所有策略规则，返回每条规则的结果
+func (ps PresetPolicies) Evaluate(workload *UniversalWorkload, patch *UniversalPatch) (results []PolicyResult, err error) {
+	if err = ps.Validate(); err != nil {
+		return
+	}
+	for _, pp := range ps {
+		if len(pp.Namespaces) > 0 && !matchPatterns(pp.Namespaces, workload.Namespace) {
+			results = append(results, PolicyResult{ID: pp.ID, Skipped: true, Message: "命名空间 " + workload.Namespace + " 不在规则生效范围内"})
+			continue
+		}
+		var violations []string
+		if violations, err = pp.evaluate(workload, patch); err != nil {
+			return
+		}
+		results = append(results, PolicyResult{
+			ID:       pp.ID,
+			Violated: len(violations) > 0,
+			Message:  strings.Join(violations, "; "),
+		})
+	}
+	return
+}
+
+// CheckPolicyResults 如果存在违反的策略规则，返回包含所有违反规则 id 的错误
+func CheckPolicyResults(results []PolicyResult) error {
+	var ids []string
+	for _, r := range results {
+		if r.Violated {
+			ids = append(ids, r.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return fmt.Errorf("违反集群策略: %s", strings.Join(ids, ", "))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testPresetPolicies = `
+policies:
+  - id: prod-probes
+    type: requireProbes
+    namespaces: ["prod-*"]
+  - id: registry
+    type: imageRegistry
+    registries: ["registry.example.com"]
+  - id: no-hostpath
+    type: noHostPath
+  - id: ns-allowlist
+    type: namespaceAllowlist
+    allowed: ["prod-*", "test-*"]
+`
+	testManifestPolicies = `
+version: 2
+default:
+  volumes:
+    logs:
+      hostPath:
+        path: /var/log
+`
+)
+
+func TestPresetPolicies_Evaluate(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetPolicies), &preset))
+	var m Manifest
+	require.NoError(t, LoadManifest([]byte(testManifestPolicies), &m))
+	profile, err := m.Profile("dev")
+	require.NoError(t, err)
+
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/prod-web/deployment/whoa"))
+	p, err := CreateUniversalPatch(&preset, &profile, workload, &UniversalAttachments{}, "docker.io/whoa:dev")
+	require.NoError(t, err)
+
+	results, err := preset.Policies.Evaluate(workload, &p)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.True(t, results[0].Violated)
+	assert.True(t, results[1].Violated)
+	assert.True(t, results[2].Violated)
+	assert.False(t, results[3].Violated)
+	err = CheckPolicyResults(results)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "prod-probes, registry, no-hostpath")
+
+	workload = &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/other/deployment/whoa"))
+	p, err = CreateUniversalPatch(&preset, &Profile{}, workload, &UniversalAttachments{}, "registry.example.com/whoa:dev")
+	require.NoError(t, err)
+	results, err = preset.Policies.Evaluate(workload, &p)
+	require.NoError(t, err)
+	assert.True(t, results[0].Skipped)
+	assert.False(t, results[1].Violated)
+	assert.False(t, results[2].Violated)
+	assert.True(t, results[3].Violated)
+	err = CheckPolicyResults(results)
+	require.Error(t, err)
+	assert.Equal(t, "违反集群策略: ns-allowlist", err.Error())
+}
+
+func TestPresetPolicies_RequireProbesSidecars(t *testing.T) {
+	profile := &Profile{
+		Check:    UniversalCheck{Path: "/healthz", Port: 8080},
+		Sidecars: ProfileSidecars{"filebeat": {Image: "elastic/filebeat"}},
+	}
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/prod-web/deployment/whoa"))
+	p, err := CreateUniversalPatch(&Preset{}, profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	require.Len(t, p.Spec.Template.Spec.Containers, 2)
+
+	// 边车容器不支持探针，不参与 requireProbes 校验
+	results, err := PresetPolicies{{ID: "probes", Type: PolicyTypeRequireProbes}}.Evaluate(workload, &p)
+	require.NoError(t, err)
+	assert.False(t, results[0].Violated)
+}
+
+func TestPresetPolicies_EvaluateInvalid(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+	_, err := PresetPolicies{{ID: "a", Type: "unknown"}}.Evaluate(workload, &UniversalPatch{})
+	assert.Error(t, err)
+	_, err = PresetPolicies{{Type: PolicyTypeNoHostPath}}.Evaluate(workload, &UniversalPatch{})
+	assert.Error(t, err)
+	_, err = PresetPolicies{{ID: "a", Type: PolicyTypeNoHostPath}, {ID: "a", Type: PolicyTypeNoHostPath}}.Evaluate(workload, &UniversalPatch{})
+	assert.Error(t, err)
+	_, err = PresetPolicies{{ID: "a", Type: PolicyTypeNamespaceAllowlist}}.Evaluate(workload, &UniversalPatch{})
+	assert.Error(t, err)
+
+	// 加载集群预置文件时校验
+	var preset Preset
+	err = LoadPreset([]byte("policies:\n  - id: ns\n    type: namespaceAllowlist\n    allowed: []"), &preset)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allowed")
+}
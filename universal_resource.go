@@ -2,20 +2,24 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"strconv"
 	"strings"
 )
 
 const (
-	ResourceInfinity int64 = -1
+	// ResourceUnlimited 限制值为 - 代表无限制
+	ResourceUnlimited = "-"
 )
 
-// UniversalResource 资源配额，Request 不允许 0 值，Limit 允许 0 值代表无限制，针对 CPU 单位为 m，针对内存单位为 Mi
+// UniversalResource 资源配额，格式为 申请值:限制值，只写一个值代表申请值与限制值相等
+// 支持 Kubernetes 数量格式，比如 0.5, 500m, 1Gi；为了兼容旧版本，不带单位的整数针对 CPU 单位为 m，针对内存和存储单位为 Mi
 type UniversalResource struct {
-	Request int64
-	Limit   int64
+	Request string
+	Limit   string
+
+	// Source 配额的来源，比如命令行参数 --cpu，用于错误信息
+	Source string
 }
 
 func (l *UniversalResource) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
@@ -30,53 +34,84 @@ func (l *UniversalResource) UnmarshalYAML(unmarshal func(interface{}) error) (er
 }
 
 func (l UniversalResource) IsZero() bool {
-	return l.Request == 0 && l.Limit == 0
+	return l.Request == "" && l.Limit == ""
+}
+
+func (l UniversalResource) IsUnlimited() bool {
+	return l.Limit == ResourceUnlimited
 }
 
 func (l UniversalResource) String() string {
-	if l.Limit == ResourceInfinity {
-		return fmt.Sprintf("%d:-", l.Request)
+	if l.IsZero() {
+		return ""
 	}
-	return fmt.Sprintf("%d:%d", l.Request, l.Limit)
+	return l.Request + ":" + l.Limit
 }
 
 func (l *UniversalResource) Set(s string) (err error) {
-	splits := strings.Split(s, ":")
-	if len(splits) != 2 {
-		err = errors.New("资源配额格式不正确")
+	splits := strings.Split(strings.TrimSpace(s), ":")
+	var r UniversalResource
+	switch len(splits) {
+	case 1:
+		r.Request, r.Limit = strings.TrimSpace(splits[0]), strings.TrimSpace(splits[0])
+	case 2:
+		r.Request, r.Limit = strings.TrimSpace(splits[0]), strings.TrimSpace(splits[1])
+	default:
+		err = errors.New("格式应为 \"申请值:限制值\"，实际为 \"" + s + "\"")
 		return
 	}
-	if l.Request, err = strconv.ParseInt(splits[0], 10, 64); err != nil {
+	// 不带单位的整数在生成时才能确定单位，这里仅校验格式
+	if _, err = r.Generate(""); err != nil {
 		return
 	}
-	if splits[1] == "-" {
-		l.Limit = ResourceInfinity
-	} else {
-		if l.Limit, err = strconv.ParseInt(splits[1], 10, 64); err != nil {
-			return
-		}
+	r.Source = l.Source
+	*l = r
+	return
+}
+
+// parseResourceQuantity 解析资源数量，不带单位的整数使用 unit 作为单位
+func parseResourceQuantity(s string, unit string) (q resource.Quantity, err error) {
+	if _, e := strconv.ParseInt(s, 10, 64); e == nil {
+		s = s + unit
 	}
-	if l.Request <= 0 || (l.Limit != ResourceInfinity && l.Limit < l.Request) {
-		err = errors.New("资源配额格式不正确")
+	if q, err = resource.ParseQuantity(s); err != nil {
+		err = errors.New("无法解析数量 \"" + s + "\"")
 		return
 	}
 	return
 }
 
-func (l UniversalResource) AsCPU() (resource.Quantity, resource.Quantity) {
-	if l.Limit == ResourceInfinity {
-		return resource.MustParse(fmt.Sprintf("%dm", l.Request)),
-			resource.MustParse(fmt.Sprintf("999"))
-	}
-	return resource.MustParse(fmt.Sprintf("%dm", l.Request)),
-		resource.MustParse(fmt.Sprintf("%dm", l.Limit))
+// UniversalResourceQuantities 资源配额的解析结果，Limit 为 nil 代表无限制
+type UniversalResourceQuantities struct {
+	Request resource.Quantity
+	Limit   *resource.Quantity
 }
 
-func (l UniversalResource) AsMEM() (resource.Quantity, resource.Quantity) {
-	if l.Limit == ResourceInfinity {
-		return resource.MustParse(fmt.Sprintf("%dMi", l.Request)),
-			resource.MustParse(fmt.Sprintf("999Gi"))
+// Generate 使用 unit 作为不带单位的整数的单位，解析申请值和限制值
+func (l UniversalResource) Generate(unit string) (out UniversalResourceQuantities, err error) {
+	if out.Request, err = parseResourceQuantity(l.Request, unit); err != nil {
+		err = errors.New("申请值" + err.Error())
+		return
 	}
-	return resource.MustParse(fmt.Sprintf("%dMi", l.Request)),
-		resource.MustParse(fmt.Sprintf("%dMi", l.Limit))
+	if out.Request.Sign() <= 0 {
+		err = errors.New("申请值必须大于 0")
+		return
+	}
+	if l.IsUnlimited() {
+		return
+	}
+	var limit resource.Quantity
+	if limit, err = parseResourceQuantity(l.Limit, unit); err != nil {
+		err = errors.New("限制值" + err.Error())
+		return
+	}
+	// 单位尚未确定时，混用整数和数量格式的值无法比较
+	_, re := strconv.ParseInt(l.Request, 10, 64)
+	_, le := strconv.ParseInt(l.Limit, 10, 64)
+	if (unit != "" || (re == nil) == (le == nil)) && limit.Cmp(out.Request) < 0 {
+		err = errors.New("限制值 " + l.Limit + " (" + limit.String() + ") 不能小于申请值 " + l.Request + " (" + out.Request.String() + ")")
+		return
+	}
+	out.Limit = &limit
+	return
 }
@@ -1,6 +1,188 @@
 package main
 
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+const (
+	ResourceKeyCPU     = "cpu"
+	ResourceKeyMEM     = "mem"
+	ResourceKeyStorage = "storage"
+)
+
+// UniversalResourceList 资源配额列表，cpu, mem 和 storage (ephemeral-storage) 以外的键均视为扩展资源，比如 nvidia.com/gpu
 type UniversalResourceList struct {
-	CPU *UniversalResource `yaml:"cpu"`
-	MEM *UniversalResource `yaml:"mem"`
+	CPU     *UniversalResource `yaml:"cpu"`
+	MEM     *UniversalResource `yaml:"mem"`
+	Storage *UniversalResource `yaml:"storage"`
+
+	// Extended 扩展资源，申请值与限制值必须相等
+	Extended map[string]*UniversalResource `yaml:"-"`
+}
+
+func (rl *UniversalResourceList) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var m map[string]string
+	if err = unmarshal(&m); err != nil {
+		return
+	}
+	var out UniversalResourceList
+	for k, v := range m {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		r := &UniversalResource{}
+		if err = r.Set(v); err != nil {
+			err = errors.New("resource." + k + " 格式不正确: " + err.Error())
+			return
+		}
+		switch k {
+		case ResourceKeyCPU:
+			out.CPU = r
+		case ResourceKeyMEM:
+			out.MEM = r
+		case ResourceKeyStorage:
+			out.Storage = r
+		default:
+			if !isExtendedResourceName(k) {
+				err = errors.New("resource." + k + " 不是已知的资源类型，扩展资源名需要包含域名前缀，比如 nvidia.com/gpu")
+				return
+			}
+			if out.Extended == nil {
+				out.Extended = map[string]*UniversalResource{}
+			}
+			out.Extended[k] = r
+		}
+	}
+	*rl = out
+	return
+}
+
+// MarshalYAML 输出为与配置文件相同的 键: 申请值:限制值 格式
+func (rl UniversalResourceList) MarshalYAML() (interface{}, error) {
+	out := map[string]string{}
+	for _, item := range rl.items() {
+		out[item.Field] = item.Resource.String()
+	}
+	return out, nil
+}
+
+func isExtendedResourceName(name string) bool {
+	return strings.Contains(name, "/") || strings.HasPrefix(name, corev1.ResourceHugePagesPrefix)
+}
+
+// Override 以 rl 为基础，使用 o 中设置的资源覆盖同名资源
+func (rl UniversalResourceList) Override(o UniversalResourceList) (out UniversalResourceList) {
+	out = rl
+	if o.CPU != nil {
+		out.CPU = o.CPU
+	}
+	if o.MEM != nil {
+		out.MEM = o.MEM
+	}
+	if o.Storage != nil {
+		out.Storage = o.Storage
+	}
+	if rl.Extended != nil || o.Extended != nil {
+		out.Extended = map[string]*UniversalResource{}
+		for k, v := range rl.Extended {
+			out.Extended[k] = v
+		}
+		for k, v := range o.Extended {
+			out.Extended[k] = v
+		}
+	}
+	return
+}
+
+type universalResourceItem struct {
+	Field    string
+	Name     corev1.ResourceName
+	Unit     string
+	Resource *UniversalResource
+}
+
+// Label 返回用于错误信息的字段名，命令行参数优先
+func (item universalResourceItem) Label() string {
+	if item.Resource.Source != "" {
+		return item.Resource.Source
+	}
+	return "resource." + item.Field
+}
+
+// items 返回所有设置了的资源，扩展资源按照名称排序
+func (rl UniversalResourceList) items() (out []universalResourceItem) {
+	if rl.CPU != nil {
+		out = append(out, universalResourceItem{Field: ResourceKeyCPU, Name: corev1.ResourceCPU, Unit: "m", Resource: rl.CPU})
+	}
+	if rl.MEM != nil {
+		out = append(out, universalResourceItem{Field: ResourceKeyMEM, Name: corev1.ResourceMemory, Unit: "Mi", Resource: rl.MEM})
+	}
+	if rl.Storage != nil {
+		out = append(out, universalResourceItem{Field: ResourceKeyStorage, Name: corev1.ResourceEphemeralStorage, Unit: "Mi", Resource: rl.Storage})
+	}
+	var keys []string
+	for k, v := range rl.Extended {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, universalResourceItem{Field: k, Name: corev1.ResourceName(k), Resource: rl.Extended[k]})
+	}
+	return
+}
+
+// Generate 生成容器的资源配额，错误信息中包含出错的字段
+// 限制值为 - 时，如果 capacity 中设置了同名资源，则使用其限制值作为上限，否则不设置限制值，并在 unlimited 中返回资源名，用于在补丁中删除已有的限制值
+func (rl UniversalResourceList) Generate(capacity UniversalResourceList) (out corev1.ResourceRequirements, unlimited []corev1.ResourceName, err error) {
+	caps := map[corev1.ResourceName]universalResourceItem{}
+	for _, item := range capacity.items() {
+		caps[item.Name] = item
+	}
+	for _, item := range rl.items() {
+		var q UniversalResourceQuantities
+		if q, err = item.Resource.Generate(item.Unit); err != nil {
+			err = errors.New(item.Label() + " 格式不正确: " + err.Error())
+			return
+		}
+		if item.Unit == "" && (q.Limit == nil || q.Limit.Cmp(q.Request) != 0) {
+			err = errors.New("resource." + item.Field + " 是扩展资源，申请值与限制值必须相等")
+			return
+		}
+		if q.Limit == nil {
+			if c, ok := caps[item.Name]; ok {
+				var cq UniversalResourceQuantities
+				if cq, err = c.Resource.Generate(c.Unit); err != nil {
+					err = errors.New("unlimitedCap." + c.Field + " 格式不正确: " + err.Error())
+					return
+				}
+				if cq.Limit == nil {
+					err = errors.New("unlimitedCap." + c.Field + " 不能为无限制")
+					return
+				}
+				if cq.Limit.Cmp(q.Request) < 0 {
+					err = errors.New(item.Label() + " 的申请值 " + q.Request.String() + " 超过了集群预置文件中 unlimitedCap." + c.Field + " 的上限 " + cq.Limit.String())
+					return
+				}
+				q.Limit = cq.Limit
+			}
+		}
+		if out.Requests == nil {
+			out.Requests = corev1.ResourceList{}
+		}
+		out.Requests[item.Name] = q.Request
+		if q.Limit == nil {
+			unlimited = append(unlimited, item.Name)
+			continue
+		}
+		if out.Limits == nil {
+			out.Limits = corev1.ResourceList{}
+		}
+		out.Limits[item.Name] = *q.Limit
+	}
+	return
 }
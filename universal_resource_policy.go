@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"log"
+	"sort"
+)
+
+const (
+	ResourcePolicyActionReject = "reject"
+	ResourcePolicyActionClamp  = "clamp"
+)
+
+// PresetResourcePolicy 集群资源策略，限制申请值和限制值的上限，限制值与申请值的比例，以及是否允许无限制
+// action 为 reject (默认) 时拒绝部署，为 clamp 时调整到允许的范围内并输出警告
+type PresetResourcePolicy struct {
+	Action         string             `yaml:"action"`
+	MaxRequest     map[string]string  `yaml:"maxRequest"`
+	MaxLimit       map[string]string  `yaml:"maxLimit"`
+	MaxRatio       map[string]float64 `yaml:"maxRatio"`
+	AllowUnlimited *bool              `yaml:"allowUnlimited"`
+}
+
+// Validate 校验资源策略，maxRatio 小于 1 时限制值会小于申请值，无法通过 API Server 的校验
+func (rp PresetResourcePolicy) Validate() (err error) {
+	var keys []string
+	for k := range rp.MaxRatio {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := rp.MaxRatio[k]; !(v >= 1) {
+			err = fmt.Errorf("resourcePolicy.maxRatio.%s 不能小于 1: %v", k, v)
+			return
+		}
+	}
+	return
+}
+
+func (rp PresetResourcePolicy) quantity(field string, values map[string]string, item universalResourceItem) (q *resource.Quantity, err error) {
+	s, ok := values[item.Field]
+	if !ok {
+		return
+	}
+	var v resource.Quantity
+	if v, err = parseResourceQuantity(s, item.Unit); err != nil {
+		err = errors.New("resourcePolicy." + field + "." + item.Field + " 格式不正确: " + err.Error())
+		return
+	}
+	q = &v
+	return
+}
+
+// Enforce 校验容器 name 的资源配额 res 是否符合资源策略，rl 为生成 res 使用的资源配额列表，用于在错误信息中指出具体的字段
+// 返回调整后的资源配额和无限制的资源名
+func (rp PresetResourcePolicy) Enforce(name string, rl UniversalResourceList, res corev1.ResourceRequirements, unlimited []corev1.ResourceName) (out corev1.ResourceRequirements, outUnlimited []corev1.ResourceName, err error) {
+	clamp := false
+	switch rp.Action {
+	case "", ResourcePolicyActionReject:
+	case ResourcePolicyActionClamp:
+		clamp = true
+	default:
+		err = errors.New("resourcePolicy.action 只支持 reject 和 clamp")
+		return
+	}
+
+	out = corev1.ResourceRequirements{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for k, v := range res.Requests {
+		out.Requests[k] = v
+	}
+	for k, v := range res.Limits {
+		out.Limits[k] = v
+	}
+	isUnlimited := map[corev1.ResourceName]bool{}
+	for _, n := range unlimited {
+		isUnlimited[n] = true
+	}
+
+	for _, item := range rl.items() {
+		label := item.Label()
+		violate := func(msg string, fixed string) error {
+			if clamp {
+				log.Printf("警告: 容器 %s 的 %s %s，已调整为 %s", name, label, msg, fixed)
+				return nil
+			}
+			return errors.New("容器 " + name + " 的 " + label + " 违反集群资源策略: " + msg)
+		}
+
+		var maxRequest, maxLimit *resource.Quantity
+		if maxRequest, err = rp.quantity("maxRequest", rp.MaxRequest, item); err != nil {
+			return
+		}
+		if maxLimit, err = rp.quantity("maxLimit", rp.MaxLimit, item); err != nil {
+			return
+		}
+		ratio, hasRatio := rp.MaxRatio[item.Field]
+
+		request, ok := out.Requests[item.Name]
+		if !ok {
+			continue
+		}
+
+		// 申请值上限
+		if maxRequest != nil && request.Cmp(*maxRequest) > 0 {
+			if err = violate(fmt.Sprintf("申请值 %s 超过上限 %s", request.String(), maxRequest.String()), maxRequest.String()); err != nil {
+				return
+			}
+			request = maxRequest.DeepCopy()
+			out.Requests[item.Name] = request
+		}
+
+		// 无限制
+		if isUnlimited[item.Name] && rp.AllowUnlimited != nil && !*rp.AllowUnlimited {
+			var limit *resource.Quantity
+			if maxLimit != nil {
+				limit = maxLimit
+			} else if hasRatio {
+				limit = resource.NewMilliQuantity(int64(float64(request.MilliValue())*ratio), request.Format)
+			}
+			if limit == nil {
+				err = errors.New("容器 " + name + " 的 " + label + " 违反集群资源策略: 不允许无限制的限制值")
+				return
+			}
+			if err = violate("不允许无限制的限制值", limit.String()); err != nil {
+				return
+			}
+			out.Limits[item.Name] = *limit
+			delete(isUnlimited, item.Name)
+			// 替换后的限制值不能小于申请值
+			if request.Cmp(*limit) > 0 {
+				if err = violate(fmt.Sprintf("申请值 %s 超过限制值 %s", request.String(), limit.String()), limit.String()); err != nil {
+					return
+				}
+				request = limit.DeepCopy()
+				out.Requests[item.Name] = request
+			}
+		}
+
+		limit, ok := out.Limits[item.Name]
+		if !ok {
+			continue
+		}
+
+		// 限制值上限
+		if maxLimit != nil && limit.Cmp(*maxLimit) > 0 {
+			if err = violate(fmt.Sprintf("限制值 %s 超过上限 %s", limit.String(), maxLimit.String()), maxLimit.String()); err != nil {
+				return
+			}
+			limit = maxLimit.DeepCopy()
+			out.Limits[item.Name] = limit
+			if request.Cmp(limit) > 0 {
+				out.Requests[item.Name] = limit.DeepCopy()
+				request = limit
+			}
+		}
+
+		// 限制值与申请值的比例
+		if hasRatio && request.MilliValue() > 0 {
+			actual := float64(limit.MilliValue()) / float64(request.MilliValue())
+			if actual > ratio {
+				fixed := resource.NewMilliQuantity(int64(float64(request.MilliValue())*ratio), limit.Format)
+				if err = violate(fmt.Sprintf("限制值与申请值的比例 %.2f 超过上限 %.2f", actual, ratio), fixed.String()); err != nil {
+					return
+				}
+				out.Limits[item.Name] = *fixed
+			}
+		}
+	}
+
+	for _, n := range unlimited {
+		if isUnlimited[n] {
+			outUnlimited = append(outUnlimited, n)
+		}
+	}
+	if len(out.Requests) == 0 {
+		out.Requests = nil
+	}
+	if len(out.Limits) == 0 {
+		out.Limits = nil
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+const (
+	testPresetResourcePolicy = `
+resourcePolicy:
+  maxRequest:
+    cpu: 2.0
+  maxLimit:
+    cpu: 4.0
+    mem: 4Gi
+  maxRatio:
+    mem: 2
+  allowUnlimited: false
+`
+)
+
+func TestPresetResourcePolicy_Enforce(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetResourcePolicy), &preset))
+
+	generate := func(s string) (UniversalResourceList, error) {
+		var rl UniversalResourceList
+		require.NoError(t, yaml.Unmarshal([]byte(s), &rl))
+		res, unlimited, err := rl.Generate(UniversalResourceList{})
+		require.NoError(t, err)
+		_, _, err = preset.ResourcePolicy.Enforce("whoa", rl, res, unlimited)
+		return rl, err
+	}
+
+	_, err := generate("cpu: 0.5:2.0\nmem: 1Gi:2Gi")
+	assert.NoError(t, err)
+
+	_, err = generate("cpu: 3.0:4.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource.cpu")
+	assert.Contains(t, err.Error(), "申请值")
+
+	_, err = generate("cpu: 1.0:8.0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "限制值")
+
+	_, err = generate("mem: 1Gi:3Gi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "比例")
+
+	_, err = generate("cpu: 1.0:-")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "无限制")
+
+	// 申请值超过替换后的限制值
+	_, err = generate("mem: 6Gi:-")
+	require.Error(t, err)
+
+	// 命令行参数
+	cpu := UniversalResource{Source: "--cpu"}
+	require.NoError(t, cpu.Set("3000:4000"))
+	rl := UniversalResourceList{CPU: &cpu}
+	res, unlimited, err := rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	_, _, err = preset.ResourcePolicy.Enforce("whoa", rl, res, unlimited)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--cpu")
+}
+
+func TestPresetResourcePolicy_Clamp(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetResourcePolicy), &preset))
+	preset.ResourcePolicy.Action = ResourcePolicyActionClamp
+
+	var rl UniversalResourceList
+	require.NoError(t, yaml.Unmarshal([]byte("cpu: 3.0:8.0\nmem: 1Gi:-"), &rl))
+	res, unlimited, err := rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	res, unlimited, err = preset.ResourcePolicy.Enforce("whoa", rl, res, unlimited)
+	require.NoError(t, err)
+	assert.Empty(t, unlimited)
+	assert.Equal(t, "2", res.Requests.Cpu().String())
+	assert.Equal(t, "4", res.Limits.Cpu().String())
+	assert.Equal(t, "1Gi", res.Requests.Memory().String())
+	assert.Equal(t, "2Gi", res.Limits.Memory().String())
+}
+
+func TestPresetResourcePolicy_ClampUnlimitedRequest(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetResourcePolicy), &preset))
+	preset.ResourcePolicy.Action = ResourcePolicyActionClamp
+
+	// 无限制的限制值替换为 maxLimit 之后，申请值不能超过限制值
+	var rl UniversalResourceList
+	require.NoError(t, yaml.Unmarshal([]byte("mem: 6Gi:-"), &rl))
+	res, unlimited, err := rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	res, unlimited, err = preset.ResourcePolicy.Enforce("whoa", rl, res, unlimited)
+	require.NoError(t, err)
+	assert.Empty(t, unlimited)
+	assert.Equal(t, "4Gi", res.Limits.Memory().String())
+	assert.Equal(t, "4Gi", res.Requests.Memory().String())
+}
+
+func TestPresetResourcePolicy_Validate(t *testing.T) {
+	var preset Preset
+	require.NoError(t, LoadPreset([]byte(testPresetResourcePolicy), &preset))
+
+	for _, ratio := range []string{"0.5", "-1", "0", ".nan"} {
+		preset = Preset{}
+		err := LoadPreset([]byte("resourcePolicy:\n  maxRatio:\n    cpu: "+ratio), &preset)
+		require.Error(t, err, ratio)
+		assert.Contains(t, err.Error(), "maxRatio.cpu")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestUniversalResource_Set(t *testing.T) {
+	var r UniversalResource
+	require.NoError(t, r.Set("100:200"))
+	assert.Equal(t, "100", r.Request)
+	assert.Equal(t, "200", r.Limit)
+	require.NoError(t, r.Set("0.5:2"))
+	require.NoError(t, r.Set("512Mi:1Gi"))
+	require.NoError(t, r.Set("1Gi"))
+	assert.Equal(t, "1Gi", r.Limit)
+	require.NoError(t, r.Set("200:-"))
+	assert.True(t, r.IsUnlimited())
+
+	assert.Error(t, r.Set("0:100"))
+	assert.Error(t, r.Set("200:100"))
+	assert.Error(t, r.Set("1Gi:512Mi"))
+	assert.Error(t, r.Set("abc:100"))
+	assert.Error(t, r.Set("1:2:3"))
+}
+
+func TestUniversalResourceList_Generate(t *testing.T) {
+	var rl UniversalResourceList
+	require.NoError(t, yaml.Unmarshal([]byte(`
+cpu: 0.5:2000m
+mem: 512
+storage: 1Gi:2Gi
+nvidia.com/gpu: 1
+`), &rl))
+	res, _, err := rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	assert.Equal(t, "500m", res.Requests.Cpu().String())
+	assert.Equal(t, "2", res.Limits.Cpu().String())
+	assert.Equal(t, "512Mi", res.Requests.Memory().String())
+	assert.Equal(t, "512Mi", res.Limits.Memory().String())
+	assert.Equal(t, "1Gi", res.Requests.StorageEphemeral().String())
+	assert.Equal(t, "2Gi", res.Limits.StorageEphemeral().String())
+	gpu := res.Limits["nvidia.com/gpu"]
+	assert.Equal(t, "1", gpu.String())
+
+	rl = UniversalResourceList{}
+	require.NoError(t, yaml.Unmarshal([]byte(`cpu: 100:-`), &rl))
+	res, unlimited, err := rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	assert.Equal(t, "100m", res.Requests.Cpu().String())
+	_, ok := res.Limits[corev1.ResourceCPU]
+	assert.False(t, ok)
+	assert.Equal(t, []corev1.ResourceName{corev1.ResourceCPU}, unlimited)
+
+	var capacity UniversalResourceList
+	require.NoError(t, yaml.Unmarshal([]byte(`cpu: 4.0`), &capacity))
+	res, unlimited, err = rl.Generate(capacity)
+	require.NoError(t, err)
+	assert.Equal(t, "4", res.Limits.Cpu().String())
+	assert.Empty(t, unlimited)
+	require.NoError(t, yaml.Unmarshal([]byte(`cpu: 50m`), &capacity))
+	_, _, err = rl.Generate(capacity)
+	assert.Error(t, err)
+
+	err = yaml.Unmarshal([]byte(`mem: 200:abc`), &rl)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource.mem")
+	err = yaml.Unmarshal([]byte(`gpu: 1`), &rl)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource.gpu")
+
+	rl = UniversalResourceList{}
+	require.NoError(t, yaml.Unmarshal([]byte(`cpu: 0.5:2`), &rl))
+	_, _, err = rl.Generate(UniversalResourceList{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2m")
+
+	rl = UniversalResourceList{}
+	require.NoError(t, yaml.Unmarshal([]byte(`mem: 1:1Gi`), &rl))
+	_, _, err = rl.Generate(UniversalResourceList{})
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal([]byte(`mem: 2048:1Gi`), &rl))
+	_, _, err = rl.Generate(UniversalResourceList{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "resource.mem")
+	require.NoError(t, yaml.Unmarshal([]byte(`nvidia.com/gpu: 1:2`), &rl))
+	_, _, err = rl.Generate(UniversalResourceList{})
+	assert.Error(t, err)
+}
+
+func TestCreateUniversalPatch_Unlimited(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+
+	var profile Profile
+	require.NoError(t, yaml.Unmarshal([]byte(`
+resource:
+  cpu: 100:-
+  mem: 128:256
+`), &profile))
+	p, err := CreateUniversalPatch(&Preset{}, &profile, workload, &UniversalAttachments{}, "whoa:dev")
+	require.NoError(t, err)
+	assert.Equal(t, []corev1.ResourceName{corev1.ResourceCPU}, p.UnlimitedResources["whoa"])
+
+	buf, err := json.Marshal(p)
+	require.NoError(t, err)
+	var out struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Resources struct {
+							Limits map[string]*string `json:"limits"`
+						} `json:"resources"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &out))
+	limits := out.Spec.Template.Spec.Containers[0].Resources.Limits
+	v, ok := limits["cpu"]
+	assert.True(t, ok)
+	assert.Nil(t, v)
+	assert.Equal(t, "256Mi", *limits["memory"])
+}
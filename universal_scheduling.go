@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+)
+
+const (
+	// LabelWorkload 添加到 Pod 模板上的标签，用来在反亲和性，拓扑分布约束等场景中选择工作负载的 Pod
+	LabelWorkload = "net.guoyk.deployer/workload"
+
+	SpreadHostname = "hostname"
+	SpreadZone     = "zone"
+)
+
+var (
+	spreadTopologyKeys = map[string]string{
+		SpreadHostname: corev1.LabelHostname,
+		SpreadZone:     corev1.LabelZoneFailureDomainStable,
+	}
+)
+
+// expandTopologyKey 将简写 hostname 和 zone 展开为完整的拓扑键
+func expandTopologyKey(key string) string {
+	if k, ok := spreadTopologyKeys[key]; ok {
+		return k
+	}
+	return key
+}
+
+type UniversalToleration struct {
+	Key               string `yaml:"key"`
+	Operator          string `yaml:"operator"`
+	Value             string `yaml:"value"`
+	Effect            string `yaml:"effect"`
+	TolerationSeconds *int64 `yaml:"tolerationSeconds"`
+}
+
+type UniversalTopologySpreadConstraint struct {
+	MaxSkew           int32  `yaml:"maxSkew"`
+	TopologyKey       string `yaml:"topologyKey"`
+	WhenUnsatisfiable string `yaml:"whenUnsatisfiable"`
+}
+
+// UniversalScheduling 调度约束，集群预置文件和环境配置中均可设置，合并顺序为 preset → default → 环境
+type UniversalScheduling struct {
+	NodeSelector              map[string]string                   `yaml:"nodeSelector"`
+	Tolerations               []UniversalToleration               `yaml:"tolerations"`
+	Spread                    string                              `yaml:"spread"`
+	TopologySpreadConstraints []UniversalTopologySpreadConstraint `yaml:"topologySpreadConstraints"`
+}
+
+// Override 以集群预置文件中的 s 为基础合并环境配置中的 o，nodeSelector 按键合并，s 中的键优先，不允许环境配置修改；
+// tolerations 追加，spread 和 topologySpreadConstraints 如果设置则整体覆盖
+func (s UniversalScheduling) Override(o UniversalScheduling) (out UniversalScheduling) {
+	if s.NodeSelector != nil || o.NodeSelector != nil {
+		out.NodeSelector = map[string]string{}
+		for k, v := range o.NodeSelector {
+			out.NodeSelector[k] = v
+		}
+		for k, v := range s.NodeSelector {
+			if ov, ok := o.NodeSelector[k]; ok && ov != v {
+				log.Printf("警告: 集群预置文件强制设置了 nodeSelector.%s 为 %s，忽略环境配置中的 %s", k, v, ov)
+			}
+			out.NodeSelector[k] = v
+		}
+	}
+	out.Tolerations = append(append(out.Tolerations, s.Tolerations...), o.Tolerations...)
+	out.Spread = s.Spread
+	if o.Spread != "" {
+		out.Spread = o.Spread
+	}
+	out.TopologySpreadConstraints = s.TopologySpreadConstraints
+	if len(o.TopologySpreadConstraints) > 0 {
+		out.TopologySpreadConstraints = o.TopologySpreadConstraints
+	}
+	return
+}
+
+func (s UniversalScheduling) GenerateTolerations() (out []corev1.Toleration) {
+	for _, t := range s.Tolerations {
+		out = append(out, corev1.Toleration{
+			Key:               t.Key,
+			Operator:          corev1.TolerationOperator(t.Operator),
+			Value:             t.Value,
+			Effect:            corev1.TaintEffect(t.Effect),
+			TolerationSeconds: t.TolerationSeconds,
+		})
+	}
+	return
+}
+
+// GenerateAffinity 使用 spread 简写生成软性的 Pod 反亲和性，尽量将同一工作负载的 Pod 分散到不同的节点或者可用区
+func (s UniversalScheduling) GenerateAffinity(workload *UniversalWorkload) (out *corev1.Affinity, err error) {
+	if s.Spread == "" {
+		return
+	}
+	key, ok := spreadTopologyKeys[s.Spread]
+	if !ok {
+		err = errors.New("spread 字段只支持 hostname 和 zone")
+		return
+	}
+	out = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{LabelWorkload: workload.Name},
+						},
+						TopologyKey: key,
+					},
+				},
+			},
+		},
+	}
+	return
+}
+
+func (s UniversalScheduling) GenerateTopologySpreadConstraints(workload *UniversalWorkload) (out []corev1.TopologySpreadConstraint, err error) {
+	for _, c := range s.TopologySpreadConstraints {
+		if c.TopologyKey == "" {
+			err = errors.New("topologySpreadConstraints 中的条目缺少 topologyKey")
+			return
+		}
+		maxSkew := c.MaxSkew
+		if maxSkew <= 0 {
+			maxSkew = 1
+		}
+		action := corev1.ScheduleAnyway
+		if c.WhenUnsatisfiable != "" {
+			action = corev1.UnsatisfiableConstraintAction(c.WhenUnsatisfiable)
+		}
+		out = append(out, corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       expandTopologyKey(c.TopologyKey),
+			WhenUnsatisfiable: action,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{LabelWorkload: workload.Name},
+			},
+		})
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"github.com/guoyk93/deployer2/pkg/secrets"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	LabelSecretOf = "net.guoyk.deployer/secret-of"
+)
+
+// CreateUniversalSecret 使用集群预置文件中的 secretKey 解密 Profile 的 secrets 字段，并创建 Secret，如果没有 secrets 字段则返回 nil
+func CreateUniversalSecret(preset *Preset, profile *Profile, workload *UniversalWorkload) (s *corev1.Secret, err error) {
+	if len(profile.Secrets) == 0 {
+		return
+	}
+	if preset.SecretKey == "" {
+		err = errors.New("集群预置文件中缺少 secretKey，无法解密 secrets 字段")
+		return
+	}
+	data := map[string][]byte{}
+	for k, v := range profile.Secrets {
+		if !secrets.IsEncrypted(v) {
+			err = errors.New("secrets 字段中的 " + k + " 未加密，请使用 deployer2 secret encrypt 命令加密")
+			return
+		}
+		if data[k], err = secrets.Decrypt(preset.SecretKey, v); err != nil {
+			err = errors.New("解密 secrets 字段中的 " + k + " 失败: " + err.Error())
+			return
+		}
+	}
+	s = &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name + "-secrets",
+			Namespace: workload.Namespace,
+			Labels: map[string]string{
+				LabelSecretOf: workload.Name,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	return
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/guoyk93/deployer2/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const (
+	testSecretKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+func TestCreateUniversalSecret(t *testing.T) {
+	enc, err := secrets.Encrypt(testSecretKey, []byte("p@ssw0rd"))
+	require.NoError(t, err)
+
+	preset := &Preset{SecretKey: testSecretKey}
+	profile := &Profile{Secrets: map[string]string{"DB_PASSWORD": enc}}
+	workload := &UniversalWorkload{Namespace: "test-ns", Name: "whoa"}
+
+	s, err := CreateUniversalSecret(preset, profile, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "whoa-secrets", s.Name)
+	assert.Equal(t, "test-ns", s.Namespace)
+	assert.Equal(t, "p@ssw0rd", string(s.Data["DB_PASSWORD"]))
+
+	profile.Secrets["PLAIN"] = "hello"
+	_, err = CreateUniversalSecret(preset, profile, workload)
+	assert.Error(t, err)
+
+	_, err = CreateUniversalSecret(&Preset{}, profile, workload)
+	assert.Error(t, err)
+
+	s, err = CreateUniversalSecret(preset, &Profile{}, workload)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	AnnotationIngressClass = "kubernetes.io/ingress.class"
+)
+
+type ProfileExposeHost struct {
+	Host string `yaml:"host"`
+	Path string `yaml:"path"`
+	Port string `yaml:"port"`
+}
+
+// ProfileExpose 对外暴露的端口，ports 引用 ports 字段中的端口名，hosts 用来生成 Ingress
+type ProfileExpose struct {
+	Ports []string            `yaml:"ports"`
+	Hosts []ProfileExposeHost `yaml:"hosts"`
+}
+
+// PresetIngress 集群的 Ingress 配置
+type PresetIngress struct {
+	Class       string            `yaml:"class"`
+	TLSSecret   string            `yaml:"tlsSecret"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// CreateUniversalService 从 Profile 的 expose 字段创建 ClusterIP 类型的 Service，如果没有暴露任何端口则返回 nil
+func CreateUniversalService(profile *Profile, workload *UniversalWorkload) (svc *corev1.Service, err error) {
+	if profile.Expose == nil || len(profile.Expose.Ports) == 0 {
+		return
+	}
+	svc = &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workload.Name,
+			Namespace: workload.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{LabelWorkload: workload.Name},
+		},
+	}
+	for _, name := range profile.Expose.Ports {
+		var found bool
+		for _, p := range profile.Ports {
+			if p.Name != name {
+				continue
+			}
+			found = true
+			var protocol corev1.Protocol
+			if protocol, err = p.GenerateProtocol(); err != nil {
+				return
+			}
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+				Name:       p.Name,
+				Protocol:   protocol,
+				Port:       int32(p.Port),
+				TargetPort: intstr.FromString(p.Name),
+			})
+		}
+		if !found {
+			err = errors.New("expose.ports 引用了未在 ports 中声明的端口: " + name)
+			return
+		}
+	}
+	return
+}
+
+// CreateUniversalIngress 从 Profile 的 expose.hosts 字段创建 Ingress，Ingress 类型和 TLS 证书取自集群预置文件，如果没有设置 hosts 则返回 nil
+func CreateUniversalIngress(preset *Preset, profile *Profile, workload *UniversalWorkload) (ing *networkingv1beta1.Ingress, err error) {
+	if profile.Expose == nil || len(profile.Expose.Hosts) == 0 {
+		return
+	}
+	if len(profile.Expose.Ports) == 0 {
+		err = errors.New("expose.hosts 需要 expose.ports 中至少有一个端口")
+		return
+	}
+	annotations := map[string]string{}
+	for k, v := range preset.Ingress.Annotations {
+		annotations[k] = v
+	}
+	if preset.Ingress.Class != "" {
+		annotations[AnnotationIngressClass] = preset.Ingress.Class
+	}
+	ing = &networkingv1beta1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1beta1", Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        workload.Name,
+			Namespace:   workload.Namespace,
+			Annotations: annotations,
+		},
+	}
+	var hosts []string
+	for _, h := range profile.Expose.Hosts {
+		if h.Host == "" {
+			err = errors.New("expose.hosts 中的条目缺少 host")
+			return
+		}
+		port := h.Port
+		if port == "" {
+			port = profile.Expose.Ports[0]
+		}
+		var exposed bool
+		for _, name := range profile.Expose.Ports {
+			if name == port {
+				exposed = true
+			}
+		}
+		if !exposed {
+			err = errors.New("expose.hosts 引用了未在 expose.ports 中声明的端口: " + port)
+			return
+		}
+		path := h.Path
+		if path == "" {
+			path = "/"
+		}
+		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1beta1.IngressRule{
+			Host: h.Host,
+			IngressRuleValue: networkingv1beta1.IngressRuleValue{
+				HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+					Paths: []networkingv1beta1.HTTPIngressPath{
+						{
+							Path: path,
+							Backend: networkingv1beta1.IngressBackend{
+								ServiceName: workload.Name,
+								ServicePort: intstr.FromString(port),
+							},
+						},
+					},
+				},
+			},
+		})
+		var duplicated bool
+		for _, host := range hosts {
+			if host == h.Host {
+				duplicated = true
+			}
+		}
+		if !duplicated {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	if preset.Ingress.TLSSecret != "" {
+		ing.Spec.TLS = []networkingv1beta1.IngressTLS{
+			{Hosts: hosts, SecretName: preset.Ingress.TLSSecret},
+		}
+	}
+	return
+}
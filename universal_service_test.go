@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCreateUniversalService(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+	profile := &Profile{
+		Ports: ProfilePorts{
+			{Name: "http", Port: 8080},
+			{Name: "metrics", Port: 9090},
+			{Name: "dns", Port: 53, Protocol: "udp"},
+		},
+	}
+
+	svc, err := CreateUniversalService(profile, workload)
+	require.NoError(t, err)
+	assert.Nil(t, svc)
+
+	profile.Expose = &ProfileExpose{Ports: []string{"http", "dns"}}
+	svc, err = CreateUniversalService(profile, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "whoa", svc.Name)
+	assert.Equal(t, "test-ns", svc.Namespace)
+	assert.Equal(t, "whoa", svc.Spec.Selector[LabelWorkload])
+	require.Len(t, svc.Spec.Ports, 2)
+	assert.Equal(t, int32(8080), svc.Spec.Ports[0].Port)
+	assert.Equal(t, "http", svc.Spec.Ports[0].TargetPort.String())
+	assert.Equal(t, "UDP", string(svc.Spec.Ports[1].Protocol))
+
+	profile.Expose.Ports = append(profile.Expose.Ports, "grpc")
+	_, err = CreateUniversalService(profile, workload)
+	assert.Error(t, err)
+}
+
+func TestUniversalAttachments_UseSelector(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+	profile := &Profile{
+		Ports:      ProfilePorts{{Name: "http", Port: 8080}},
+		Expose:     &ProfileExpose{Ports: []string{"http"}},
+		Disruption: &ProfileDisruption{MinAvailable: "1"},
+	}
+	a, err := CreateUniversalAttachments(&Preset{}, profile, workload)
+	require.NoError(t, err)
+
+	// 工作负载不存在时使用默认标签
+	require.NoError(t, a.UseSelector(nil))
+	assert.Equal(t, map[string]string{LabelWorkload: "whoa"}, a.Service.Spec.Selector)
+
+	selector, err := ParseUniversalSelector([]byte(`{"spec":{"selector":{"matchLabels":{"app":"whoa"}}}}`))
+	require.NoError(t, err)
+	require.NoError(t, a.UseSelector(selector))
+	assert.Equal(t, map[string]string{"app": "whoa"}, a.Service.Spec.Selector)
+	assert.Equal(t, "whoa", a.PodDisruptionBudget.Spec.Selector.MatchLabels["app"])
+
+	selector, err = ParseUniversalSelector([]byte(`{"spec":{"selector":{"matchExpressions":[{"key":"app","operator":"Exists"}]}}}`))
+	require.NoError(t, err)
+	assert.Error(t, a.UseSelector(selector))
+}
+
+func TestCreateUniversalIngress(t *testing.T) {
+	workload := &UniversalWorkload{}
+	require.NoError(t, workload.Set("test-cluster/test-ns/deployment/whoa"))
+	preset := &Preset{Ingress: PresetIngress{Class: "nginx", TLSSecret: "wildcard"}}
+	profile := &Profile{
+		Expose: &ProfileExpose{
+			Ports: []string{"http", "admin"},
+			Hosts: []ProfileExposeHost{
+				{Host: "www.example.com"},
+				{Host: "www.example.com", Path: "/admin", Port: "admin"},
+				{Host: "api.example.com", Path: "/v1"},
+			},
+		},
+	}
+
+	ing, err := CreateUniversalIngress(preset, profile, workload)
+	require.NoError(t, err)
+	assert.Equal(t, "nginx", ing.Annotations[AnnotationIngressClass])
+	require.Len(t, ing.Spec.Rules, 3)
+	assert.Equal(t, "/", ing.Spec.Rules[0].HTTP.Paths[0].Path)
+	assert.Equal(t, "http", ing.Spec.Rules[0].HTTP.Paths[0].Backend.ServicePort.String())
+	assert.Equal(t, "whoa", ing.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName)
+	assert.Equal(t, "admin", ing.Spec.Rules[1].HTTP.Paths[0].Backend.ServicePort.String())
+	require.Len(t, ing.Spec.TLS, 1)
+	assert.Equal(t, []string{"www.example.com", "api.example.com"}, ing.Spec.TLS[0].Hosts)
+	assert.Equal(t, "wildcard", ing.Spec.TLS[0].SecretName)
+
+	ing, err = CreateUniversalIngress(&Preset{}, profile, workload)
+	require.NoError(t, err)
+	assert.Empty(t, ing.Spec.TLS)
+
+	profile.Expose.Hosts[0].Port = "grpc"
+	_, err = CreateUniversalIngress(preset, profile, workload)
+	assert.Error(t, err)
+}
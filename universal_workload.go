@@ -32,16 +32,22 @@ func marshalLabels(v interface{}) (s string, err error) {
 	if buf, err = json.Marshal(v); err != nil {
 		return
 	}
-	var m map[string]bool
+	var m map[string]interface{}
 	if err = json.Unmarshal(buf, &m); err != nil {
 		return
 	}
 	var ks []string
 	for k, v := range m {
-		if !v {
-			continue
+		switch v := v.(type) {
+		case bool:
+			if v {
+				ks = append(ks, k)
+			}
+		case string:
+			if v != "" {
+				ks = append(ks, k+"="+v)
+			}
 		}
-		ks = append(ks, k)
 	}
 	sort.Strings(ks)
 	s = strings.Join(ks, ",")
@@ -50,9 +56,14 @@ func marshalLabels(v interface{}) (s string, err error) {
 
 func unmarshalLabels(s string, v interface{}) (err error) {
 	splits := strings.Split(s, ",")
-	m := map[string]bool{}
+	m := map[string]interface{}{}
 	for _, split := range splits {
-		m[strings.TrimSpace(split)] = true
+		// 支持 key=value 格式的标签
+		if kv := strings.SplitN(split, "=", 2); len(kv) == 2 {
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		} else {
+			m[strings.TrimSpace(split)] = true
+		}
 	}
 	var buf []byte
 	if buf, err = json.Marshal(m); err != nil {
@@ -62,17 +73,56 @@ func unmarshalLabels(s string, v interface{}) (err error) {
 	return
 }
 
-// UniversalWorkload 在多种工作负载类型下，引用其中固定的容器，默认容器名与工作负载名相等（Rancher 惯例）
+// UniversalWorkloadLabels 容器标签，init 代表初始化容器，no_check 代表不设置健康检查，role=NAME 用来指定使用环境中的哪个角色
+type UniversalWorkloadLabels struct {
+	Init    bool   `json:"init,omitempty"`
+	NoCheck bool   `json:"no_check,omitempty"`
+	Role    string `json:"role,omitempty"`
+}
+
+// UniversalWorkloadContainer 工作负载中的一个容器
+type UniversalWorkloadContainer struct {
+	Container string
+	Labels    UniversalWorkloadLabels
+}
+
+func (c UniversalWorkloadContainer) String() string {
+	l, _ := marshalLabels(c.Labels)
+	if l == "" {
+		return c.Container
+	}
+	return c.Container + "?" + l
+}
+
+func (c *UniversalWorkloadContainer) Set(s string) error {
+	labelSplits := strings.Split(s, "?")
+	if len(labelSplits) == 2 {
+		s = labelSplits[0]
+		if err := unmarshalLabels(labelSplits[1], &c.Labels); err != nil {
+			return err
+		}
+	} else if len(labelSplits) > 2 {
+		return errors.New("目标工作负载参数格式不正确")
+	}
+	c.Container = sanitizeWorkloadName(s)
+	if c.Container == "" {
+		return errors.New("目标工作负载参数缺少容器名")
+	}
+	return nil
+}
+
+// UniversalWorkload 在多种工作负载类型下，引用其中固定的容器，默认容器名与工作负载名相等（Rancher 惯例），标签 role=NAME 用来指定使用环境中的哪个角色
+// 使用 + 连接多个容器，比如 cluster/namespace/deployment/whoa/migrate?init,role=migrate+whoa，这些容器会在同一个补丁中更新
 type UniversalWorkload struct {
 	Cluster   string
 	Namespace string
 	Type      string
 	Name      string
-	Container string
-	Labels    struct {
-		Init    bool `json:"init,omitempty"`
-		NoCheck bool `json:"no_check,omitempty"`
-	}
+
+	UniversalWorkloadContainer
+
+	// Siblings 使用 + 连接的其他容器
+	Siblings []UniversalWorkloadContainer
 }
 
 func (w UniversalWorkload) String() string {
@@ -83,16 +133,59 @@ func (w UniversalWorkload) String() string {
 	sb.WriteRune('/')
 	sb.WriteString(w.Name)
 	sb.WriteRune('/')
-	sb.WriteString(w.Container)
-	l, _ := marshalLabels(w.Labels)
-	if l != "" {
-		sb.WriteRune('?')
-		sb.WriteString(l)
+	sb.WriteString(w.UniversalWorkloadContainer.String())
+	for _, c := range w.Siblings {
+		sb.WriteRune('+')
+		sb.WriteString(c.String())
 	}
 	return sb.String()
 }
 
+// Containers 返回需要更新的全部容器
+func (w UniversalWorkload) Containers() []UniversalWorkloadContainer {
+	return append([]UniversalWorkloadContainer{w.UniversalWorkloadContainer}, w.Siblings...)
+}
+
+// Primary 返回主容器，即第一个非初始化容器，用来决定 Pod 级别配置和附属资源使用的角色
+func (w UniversalWorkload) Primary() UniversalWorkloadContainer {
+	for _, c := range w.Containers() {
+		if !c.Labels.Init {
+			return c
+		}
+	}
+	return w.UniversalWorkloadContainer
+}
+
+// Resource 返回 kubectl 使用的资源名，比如 deployments/hello
+func (w UniversalWorkload) Resource() string {
+	return w.Type + "s/" + w.Name
+}
+
+// Kind 返回工作负载类型对应的 Kubernetes 资源类型，比如 Deployment
+func (w UniversalWorkload) Kind() string {
+	switch w.Type {
+	case "deployment", "deploy":
+		return "Deployment"
+	case "statefulset", "sts":
+		return "StatefulSet"
+	case "daemonset", "ds":
+		return "DaemonSet"
+	case "cronjob":
+		return "CronJob"
+	default:
+		return ""
+	}
+}
+
+// IsScalable 工作负载是否支持设置副本数
+func (w UniversalWorkload) IsScalable() bool {
+	k := w.Kind()
+	return k == "Deployment" || k == "StatefulSet"
+}
+
 func (w *UniversalWorkload) Set(s string) error {
+	containerSplits := strings.Split(s, "+")
+	s = containerSplits[0]
 	labelSplits := strings.Split(s, "?")
 	if len(labelSplits) == 2 {
 		s = labelSplits[0]
@@ -116,6 +209,18 @@ func (w *UniversalWorkload) Set(s string) error {
 	} else {
 		w.Container = w.Name
 	}
+	names := map[string]bool{w.Container: true}
+	for _, split := range containerSplits[1:] {
+		var c UniversalWorkloadContainer
+		if err := c.Set(split); err != nil {
+			return err
+		}
+		if names[c.Container] {
+			return errors.New("目标工作负载参数中存在重复的容器: " + c.Container)
+		}
+		names[c.Container] = true
+		w.Siblings = append(w.Siblings, c)
+	}
 	for _, kt := range knownWorkloadTypes {
 		if kt == w.Type {
 			return nil
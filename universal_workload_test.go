@@ -59,3 +59,31 @@ func TestUniversalWorkload_Set(t *testing.T) {
 	assert.True(t, w.Labels.NoCheck)
 	assert.True(t, w.Labels.Init)
 }
+
+func TestUniversalWorkload_SetRole(t *testing.T) {
+	w := &UniversalWorkload{}
+	err := w.Set("test-cluster/test-ns/deployment/whoa/worker?no_check,role=worker")
+	require.NoError(t, err)
+	assert.Equal(t, "worker", w.Container)
+	assert.Equal(t, "worker", w.Labels.Role)
+	assert.True(t, w.Labels.NoCheck)
+	assert.Equal(t, "test-cluster/test-ns/whoa/worker?no_check,role=worker", w.String())
+}
+
+func TestUniversalWorkload_SetSiblings(t *testing.T) {
+	w := &UniversalWorkload{}
+	err := w.Set("test-cluster/test-ns/deployment/whoa/migrate?init,role=migrate+whoa?role=web")
+	require.NoError(t, err)
+	assert.Equal(t, "migrate", w.Container)
+	assert.True(t, w.Labels.Init)
+	require.Len(t, w.Siblings, 1)
+	assert.Equal(t, "whoa", w.Siblings[0].Container)
+	assert.Equal(t, "web", w.Siblings[0].Labels.Role)
+	assert.Len(t, w.Containers(), 2)
+	assert.Equal(t, "whoa", w.Primary().Container)
+	assert.Equal(t, "test-cluster/test-ns/whoa/migrate?init,role=migrate+whoa?role=web", w.String())
+
+	w = &UniversalWorkload{}
+	err = w.Set("test-cluster/test-ns/deployment/whoa+whoa?init")
+	assert.Error(t, err)
+}